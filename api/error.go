@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sentinel errors wrapped by Error, they can be used with errors.Is to find
+// out why a call failed without inspecting the HTTP status code.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Header used to propagate the correlation ID between services
+const CorrelationIDHeader = "X-Correlation-Id"
+
+// Maximum number of bytes of a non-JSON response body kept in the error message
+const maxErrorBodySize = 512
+
+// Error is a non-OK response received from a service using the standard
+// response envelope.
+type Error struct {
+	HTTPStatus    int
+	CorrelationId string
+	Message       string
+	Details       interface{}
+	// One of the sentinel errors declared in this package, or nil if the
+	// HTTP status code does not map to any of them.
+	Err error
+}
+
+func (e *Error) Error() string {
+	m := e.Message
+	if m == "" {
+		m = http.StatusText(e.HTTPStatus)
+	}
+	if e.HTTPStatus < 200 || e.HTTPStatus > 299 {
+		m = fmt.Sprintf("[HTTP %d] %s", e.HTTPStatus, m)
+	}
+	return m
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError builds an Error from a non-OK response. The payload is parsed as a
+// standard response envelope if possible, otherwise it is used (truncated) as
+// the error message.
+func NewError(res *http.Response, payload []byte) *Error {
+	e := &Error{
+		HTTPStatus: res.StatusCode,
+		Err:        sentinel(res.StatusCode),
+	}
+
+	var envelope Response
+	if err := json.Unmarshal(payload, &envelope); err == nil {
+		e.Message = envelope.Message
+		e.CorrelationId = envelope.CorrelationId
+		e.Details = envelope.Details
+	} else {
+		e.Message = truncate(payload)
+	}
+
+	if e.CorrelationId == "" {
+		e.CorrelationId = res.Header.Get(CorrelationIDHeader)
+	}
+
+	return e
+}
+
+// Decode parses a response using the standard envelope, { "status": "ok",
+// "details": ... }. On success the details are unmarshalled into `details`,
+// which should be a pointer, or left as generic JSON if `details` is nil.
+//
+// A non-2xx HTTP status or a status other than "ok" in the envelope results in
+// an *Error.
+func Decode(res *http.Response, payload []byte, details interface{}) (*Response, error) {
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, NewError(res, payload)
+	}
+
+	var envelope struct {
+		Response
+		Details json.RawMessage `json:"details,omitempty"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("while unmarshalling response '%s': %w", truncate(payload), err)
+	}
+
+	if envelope.Status != "ok" {
+		return nil, NewError(res, payload)
+	}
+
+	ret := envelope.Response
+	if ret.CorrelationId == "" {
+		ret.CorrelationId = res.Header.Get(CorrelationIDHeader)
+	}
+
+	if len(envelope.Details) == 0 {
+		ret.Details = details
+		return &ret, nil
+	}
+
+	if details == nil {
+		if err := json.Unmarshal(envelope.Details, &ret.Details); err != nil {
+			return nil, fmt.Errorf("while unmarshalling details: %w", err)
+		}
+		return &ret, nil
+	}
+
+	if err := json.Unmarshal(envelope.Details, details); err != nil {
+		return nil, fmt.Errorf("while unmarshalling details: %w", err)
+	}
+	ret.Details = details
+
+	return &ret, nil
+}
+
+// DecodeResponse is like Decode but it reads the payload from the response
+// body, which is closed afterwards.
+func DecodeResponse(res *http.Response, details interface{}) (*Response, error) {
+	defer res.Body.Close()
+
+	payload, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("while reading response: %w", err)
+	}
+
+	return Decode(res, payload, details)
+}
+
+// Maps an HTTP status code to one of the sentinel errors.
+func sentinel(code int) error {
+	switch {
+	case code == http.StatusBadRequest, code == http.StatusUnprocessableEntity:
+		return ErrBadRequest
+	case code == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case code == http.StatusForbidden:
+		return ErrForbidden
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusConflict:
+		return ErrConflict
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+func truncate(payload []byte) string {
+	if len(payload) > maxErrorBodySize {
+		return string(payload[:maxErrorBodySize]) + "..."
+	}
+	return string(payload)
+}
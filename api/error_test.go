@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+
+	type details struct {
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		header      http.Header
+		payload     string
+		wantErr     error
+		wantMessage string
+		wantID      string
+		wantDetails details
+	}{
+		{
+			name:        "OK",
+			status:      200,
+			payload:     `{"status":"ok","details":{"name":"9spokes"}}`,
+			wantDetails: details{Name: "9spokes"},
+		},
+		{
+			name:        "Not found",
+			status:      404,
+			payload:     `{"status":"err","message":"no such connection","correlationId":"abc"}`,
+			wantErr:     ErrNotFound,
+			wantMessage: "[HTTP 404] no such connection",
+			wantID:      "abc",
+		},
+		{
+			name:        "Correlation ID from header",
+			status:      409,
+			header:      http.Header{CorrelationIDHeader: []string{"xyz"}},
+			payload:     `{"status":"err","message":"already exists"}`,
+			wantErr:     ErrConflict,
+			wantMessage: "[HTTP 409] already exists",
+			wantID:      "xyz",
+		},
+		{
+			name:        "Non-JSON error body",
+			status:      502,
+			payload:     "Bad Gateway",
+			wantErr:     ErrServer,
+			wantMessage: "[HTTP 502] Bad Gateway",
+		},
+		{
+			name:        "Non-OK status with a 200",
+			status:      200,
+			payload:     `{"status":"err","message":"invalid OSP"}`,
+			wantMessage: "invalid OSP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			res := &http.Response{StatusCode: tt.status, Header: header}
+
+			var got details
+			ret, err := Decode(res, []byte(tt.payload), &got)
+
+			if tt.wantMessage == "" {
+				require.NoError(err)
+				assert.Equal("ok", ret.Status)
+				assert.Equal(tt.wantDetails, got)
+				return
+			}
+
+			require.Error(err)
+			var apiErr *Error
+			require.True(errors.As(err, &apiErr))
+			assert.Equal(tt.status, apiErr.HTTPStatus)
+			assert.Equal(tt.wantMessage, err.Error())
+			assert.Equal(tt.wantID, apiErr.CorrelationId)
+			if tt.wantErr != nil {
+				assert.True(errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestNewErrorTruncatesBody(t *testing.T) {
+	res := &http.Response{StatusCode: 500, Header: http.Header{}}
+
+	err := NewError(res, []byte(strings.Repeat("x", 2*maxErrorBodySize)))
+
+	assert.Len(t, err.Message, maxErrorBodySize+len("..."))
+}
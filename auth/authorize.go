@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidState is returned by DecodeState when the state is malformed
+	// or its signature does not match.
+	ErrInvalidState = errors.New("invalid state")
+	// ErrExpiredState is returned by DecodeState when the state has expired.
+	ErrExpiredState = errors.New("state has expired")
+)
+
+// AuthorizationURL returns the URL of the authorization endpoint where the
+// user-agent is sent to grant access. The PKCE challenge is included when pkce
+// is not nil and the extras are added as query parameters, e.g. prompt or
+// access_type.
+func (params OAuth2) AuthorizationURL(state string, pkce *PKCE, extras map[string]string) (string, error) {
+
+	if params.ClientID == "" {
+		return "", fmt.Errorf("client_id cannot be empty")
+	}
+
+	u, err := url.Parse(params.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint '%s': %w", params.AuthorizationEndpoint, err)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", params.ClientID)
+
+	if params.RedirectURI != "" {
+		q.Set("redirect_uri", params.RedirectURI)
+	}
+
+	if len(params.Scopes) > 0 {
+		q.Set("scope", strings.Join(params.Scopes, " "))
+	}
+
+	if state != "" {
+		q.Set("state", state)
+	}
+
+	if pkce != nil {
+		q.Set("code_challenge", pkce.Challenge)
+		q.Set("code_challenge_method", pkce.Method)
+	}
+
+	for k, v := range extras {
+		q.Set(k, v)
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// State is the information carried through the authorization flow in the
+// state parameter. It is signed to make sure it has not been tampered with.
+type State struct {
+	Connection string    `json:"connection"`
+	User       string    `json:"user"`
+	Expiry     time.Time `json:"expiry"`
+	// Random value making every state unique
+	Nonce string `json:"nonce"`
+}
+
+// NewState creates a State for the specified connection and user, which
+// expires after ttl.
+func NewState(connection, user string, ttl time.Duration) (*State, error) {
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("while generating nonce: %w", err)
+	}
+
+	return &State{
+		Connection: connection,
+		User:       user,
+		Expiry:     time.Now().Add(ttl).UTC(),
+		Nonce:      base64.RawURLEncoding.EncodeToString(b),
+	}, nil
+}
+
+// Encode returns the state as a string which can be used as the state
+// parameter of the authorization URL. The state is signed with HMAC-SHA256
+// using the specified secret.
+func (s State) Encode(secret string) (string, error) {
+
+	if secret == "" {
+		return "", fmt.Errorf("secret cannot be empty")
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("while marshalling state: %w", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	return payload + "." + signState(payload, secret), nil
+}
+
+// DecodeState verifies the signature and expiry of a state created with
+// Encode and returns its content.
+func DecodeState(state, secret string) (*State, error) {
+
+	if secret == "" {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+
+	parts := strings.Split(state, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidState
+	}
+
+	if !hmac.Equal([]byte(signState(parts[0], secret)), []byte(parts[1])) {
+		return nil, ErrInvalidState
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+
+	var ret State
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, ErrInvalidState
+	}
+
+	if time.Now().After(ret.Expiry) {
+		return nil, ErrExpiredState
+	}
+
+	return &ret, nil
+}
+
+// Returns the URL-safe HMAC-SHA256 signature of the state payload
+func signState(payload, secret string) string {
+
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9spokes/go/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizationURL(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	params := auth.OAuth2{
+		AuthorizationEndpoint: "https://example.com/authorize?tenant=common",
+		ClientID:              "bogus",
+		RedirectURI:           "https://example.com/callback",
+		Scopes:                []string{"openid", "accounting"},
+	}
+	pkce := &auth.PKCE{Verifier: "verifier", Challenge: "challenge", Method: "S256"}
+
+	link, err := params.AuthorizationURL("state", pkce, map[string]string{"prompt": "consent"})
+	require.NoError(err)
+
+	u, err := url.Parse(link)
+	require.NoError(err)
+	assert.Equal("example.com", u.Host)
+	assert.Equal("/authorize", u.Path)
+	assert.Equal(url.Values{
+		"tenant":                {"common"},
+		"response_type":         {"code"},
+		"client_id":             {"bogus"},
+		"redirect_uri":          {"https://example.com/callback"},
+		"scope":                 {"openid accounting"},
+		"state":                 {"state"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+		"prompt":                {"consent"},
+	}, u.Query())
+
+	_, err = auth.OAuth2{AuthorizationEndpoint: "https://example.com"}.AuthorizationURL("", nil, nil)
+	assert.Error(err)
+}
+
+func TestState(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	state, err := auth.NewState("connection", "user", time.Minute)
+	require.NoError(err)
+	assert.NotEmpty(state.Nonce)
+
+	encoded, err := state.Encode("secret")
+	require.NoError(err)
+
+	decoded, err := auth.DecodeState(encoded, "secret")
+	require.NoError(err)
+	assert.Equal("connection", decoded.Connection)
+	assert.Equal("user", decoded.User)
+	assert.Equal(state.Nonce, decoded.Nonce)
+	assert.True(state.Expiry.Equal(decoded.Expiry))
+
+	// Safe to use in a URL without escaping
+	assert.Equal(url.QueryEscape(encoded), encoded)
+
+	// Wrong secret
+	_, err = auth.DecodeState(encoded, "other")
+	assert.ErrorIs(err, auth.ErrInvalidState)
+
+	// Empty secret
+	_, err = auth.DecodeState(encoded, "")
+	assert.Error(err)
+
+	// Tampered payload
+	other, _ := auth.State{Connection: "other", Expiry: state.Expiry}.Encode("secret")
+	tampered := strings.Split(other, ".")[0] + "." + strings.Split(encoded, ".")[1]
+	_, err = auth.DecodeState(tampered, "secret")
+	assert.ErrorIs(err, auth.ErrInvalidState)
+
+	// Expired
+	state.Expiry = time.Now().Add(-time.Second)
+	expired, _ := state.Encode("secret")
+	_, err = auth.DecodeState(expired, "secret")
+	assert.ErrorIs(err, auth.ErrExpiredState)
+}
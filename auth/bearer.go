@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	Http "github.com/9spokes/go/http/v2"
+	"github.com/9spokes/go/logging/v3"
+)
+
+// TokenSource holds the OAuth2 tokens of a connection and keeps them fresh. A
+// TokenSource is safe for concurrent use and should be shared by all the
+// requests made on behalf of the same connection, so that only one of them
+// refreshes an expired access token.
+type TokenSource struct {
+	// Parameters used to refresh the access token. The refresh token is
+	// updated whenever the token endpoint returns a new one.
+	OAuth2  OAuth2
+	Options Options
+
+	AccessToken string
+
+	// Optional callback invoked with the new token after a successful
+	// refresh, typically used to save it in the Token service with
+	// SetConnectionSetting.
+	Persist func(ctx context.Context, token *Token) error
+
+	mu sync.Mutex
+}
+
+// Token returns the current access token.
+func (s *TokenSource) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.AccessToken
+}
+
+// Middleware returns an http/v2 middleware that sets the bearer token of
+// every request. When a request is rejected with a 401 the access token is
+// refreshed, once, and the request is sent again with the new token.
+func (s *TokenSource) Middleware() Http.MiddlewareFunc {
+	return func(next Http.Middleware) Http.Middleware {
+		return func(ctx context.Context, request *Http.Request) (*Http.Response, error) {
+
+			body := request.Body
+			token := s.Token()
+
+			request.Authorization = Http.Authorization{Scheme: "Bearer", Token: token}
+
+			response, err := next(ctx, request)
+			if err != nil || response.StatusCode != http.StatusUnauthorized {
+				return response, err
+			}
+
+			logging.Debugf("Access token rejected by %s, refreshing it", request.URL)
+
+			token, err = s.refresh(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+
+			request.Body = body
+			request.Authorization = Http.Authorization{Scheme: "Bearer", Token: token}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// Refreshes the access token unless it has already been replaced since it was
+// rejected, in which case the current token is returned.
+func (s *TokenSource) refresh(ctx context.Context, rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.AccessToken != rejected {
+		return s.AccessToken, nil
+	}
+
+	token, e := s.OAuth2.Refresh(s.Options)
+	if e != nil {
+		return "", e
+	}
+
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access token in refresh response")
+	}
+
+	s.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		s.OAuth2.RefreshToken = token.RefreshToken
+	}
+
+	if s.Persist != nil {
+		if err := s.Persist(ctx, token); err != nil {
+			return "", fmt.Errorf("while persisting refreshed tokens: %w", err)
+		}
+	}
+
+	return s.AccessToken, nil
+}
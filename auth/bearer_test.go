@@ -0,0 +1,122 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/9spokes/go/auth"
+	Http "github.com/9spokes/go/http/v2"
+	"github.com/9spokes/go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSource(t *testing.T) {
+
+	var mu sync.Mutex
+	refreshes := 0
+	refreshStatus := http.StatusOK
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(refreshStatus)
+		w.Write([]byte(`{"access_token":"new-token","refresh_token":"new-refresh-token"}`))
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer new-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newSource := func() (*auth.TokenSource, *[]*auth.Token) {
+		var persisted []*auth.Token
+		return &auth.TokenSource{
+			OAuth2: auth.OAuth2{
+				TokenEndpoint: ts.URL + "/token",
+				ClientID:      "bogus",
+				ClientSecret:  "bogus",
+				RefreshToken:  "old-refresh-token",
+			},
+			AccessToken: "old-token",
+			Persist: func(ctx context.Context, token *auth.Token) error {
+				persisted = append(persisted, token)
+				return nil
+			},
+		}, &persisted
+	}
+
+	t.Run("Refresh and replay", func(t *testing.T) {
+		refreshes = 0
+		source, persisted := newSource()
+
+		request := Http.Request{URL: ts.URL + "/api", Body: []byte("payload")}
+		request.Use(source.Middleware())
+
+		response, err := request.Post(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "payload", string(response.Payload))
+		assert.Equal(t, 1, refreshes)
+		assert.Equal(t, "new-token", source.Token())
+		assert.Equal(t, "new-refresh-token", source.OAuth2.RefreshToken)
+		require.Len(t, *persisted, 1)
+		assert.Equal(t, "new-token", (*persisted)[0].AccessToken)
+
+		// The new token is used straight away
+		response, err = request.Get(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, 1, refreshes)
+	})
+
+	t.Run("Concurrent requests refresh once", func(t *testing.T) {
+		refreshes = 0
+		source, _ := newSource()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				request := Http.Request{URL: ts.URL + "/api"}
+				request.Use(source.Middleware())
+				response, err := request.Get(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusOK, response.StatusCode)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, refreshes)
+	})
+
+	t.Run("Refresh failure", func(t *testing.T) {
+		refreshStatus = http.StatusBadRequest
+		defer func() { refreshStatus = http.StatusOK }()
+		source, persisted := newSource()
+
+		request := Http.Request{URL: ts.URL + "/api"}
+		request.Use(source.Middleware())
+
+		_, err := request.Get(context.Background())
+		require.Error(t, err)
+		var e *types.ErrorResponse
+		assert.True(t, errors.As(err, &e))
+		assert.Equal(t, "old-token", source.Token())
+		assert.Empty(t, *persisted)
+	})
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/9spokes/go/types"
+)
+
+// Grant type used to poll the token endpoint in the device authorization flow
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Default interval between polls, as per RFC 8628
+const defaultDeviceInterval = 5 * time.Second
+
+// DeviceCode is the response of the device authorization endpoint. The user
+// has to visit the verification URI and enter the user code while the client
+// polls the token endpoint with PollDeviceToken.
+type DeviceCode struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// RequestDeviceCode starts the OAuth2 device authorization flow by calling the
+// DeviceAuthorizationEndpoint.
+func (params OAuth2) RequestDeviceCode(opt Options) (*DeviceCode, error) {
+
+	data := url.Values{}
+	params.setScopeAndExtras(data)
+
+	params.TokenEndpoint = params.DeviceAuthorizationEndpoint
+
+	ret, err := params.oauthRequest(opt, data)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &DeviceCode{
+		DeviceCode:              stringValue(ret["device_code"]),
+		UserCode:                stringValue(ret["user_code"]),
+		VerificationURI:         stringValue(ret["verification_uri"]),
+		VerificationURIComplete: stringValue(ret["verification_uri_complete"]),
+		ExpiresIn:               time.Duration(intValue(ret["expires_in"])) * time.Second,
+		Interval:                time.Duration(intValue(ret["interval"])) * time.Second,
+	}
+
+	// Some providers still use the name from the early drafts of the RFC
+	if dc.VerificationURI == "" {
+		dc.VerificationURI = stringValue(ret["verification_url"])
+	}
+
+	if dc.DeviceCode == "" {
+		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingDeviceCode, Message: "no device code in response"}
+	}
+
+	return dc, nil
+}
+
+// PollDeviceToken polls the token endpoint until the user has approved or
+// denied the device authorization request, the device code has expired or the
+// context is done. It returns the token once approved.
+func (params OAuth2) PollDeviceToken(ctx context.Context, dc *DeviceCode, opt Options) (*Token, error) {
+
+	if dc == nil || dc.DeviceCode == "" {
+		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingDeviceCode, Message: "the device code is missing"}
+	}
+
+	interval := dc.Interval
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+
+	if dc.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dc.ExpiresIn)
+		defer cancel()
+	}
+
+	data := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {dc.DeviceCode},
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrExpiredToken, Message: "the device code has expired", Err: ctx.Err()}
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		ret, err := params.oauthRequest(opt, data)
+		if err == nil {
+			return newToken(ret), nil
+		}
+
+		var e *types.ErrorResponse
+		if !errors.As(err, &e) {
+			return nil, err
+		}
+
+		switch e.ID {
+		case types.ErrAuthorizationPending:
+		case types.ErrSlowDown:
+			interval += defaultDeviceInterval
+		default:
+			return nil, err
+		}
+	}
+}
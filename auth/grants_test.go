@@ -0,0 +1,169 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9spokes/go/auth"
+	"github.com/9spokes/go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a token endpoint which replies with the posted form as JSON
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte(r.PostForm.Encode()))
+	}))
+}
+
+func TestClientCredentials(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	ret, err := auth.OAuth2{
+		TokenEndpoint: ts.URL,
+		ClientID:      "bogus",
+		ClientSecret:  "bogus",
+		Scopes:        []string{"read", "write"},
+	}.ClientCredentials(auth.Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "client_credentials", ret.Extra["grant_type"])
+	assert.Equal(t, "read write", ret.Scope)
+	assert.Equal(t, "bogus", ret.Extra["client_secret"])
+}
+
+func TestPasswordCredentials(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	_, err := auth.OAuth2{TokenEndpoint: ts.URL, ClientID: "bogus"}.PasswordCredentials(auth.Options{})
+	require.Error(t, err)
+	assert.Regexp(t, "username", err.Error())
+
+	ret, err := auth.OAuth2{
+		TokenEndpoint: ts.URL,
+		ClientID:      "bogus",
+		Username:      "user",
+		Password:      "secret",
+	}.PasswordCredentials(auth.Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "password", ret.Extra["grant_type"])
+	assert.Equal(t, "user", ret.Extra["username"])
+	assert.Equal(t, "secret", ret.Extra["password"])
+}
+
+func TestPKCE(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	pkce, err := auth.GeneratePKCE()
+	require.NoError(t, err)
+	assert.Len(t, pkce.Verifier, 43)
+	assert.Equal(t, "S256", pkce.Method)
+
+	hash := sha256.Sum256([]byte(pkce.Verifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(hash[:]), pkce.Challenge)
+
+	ret, err := auth.OAuth2{
+		TokenEndpoint: ts.URL,
+		ClientID:      "bogus",
+		Code:          "bogus",
+		CodeVerifier:  pkce.Verifier,
+	}.Authorize(auth.Options{})
+
+	require.NoError(t, err)
+	assert.Equal(t, pkce.Verifier, ret.Extra["code_verifier"])
+}
+
+func TestDeviceFlow(t *testing.T) {
+
+	polls := 0
+	outcome := "approved"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "bogus", r.PostForm.Get("client_id"))
+		assert.Equal(t, "accounting", r.PostForm.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"device_code":"dc","user_code":"ABCD-EFGH","verification_uri":"https://example.com/device","expires_in":600,"interval":"1"}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "dc", r.PostForm.Get("device_code"))
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		if polls < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+		if outcome == "denied" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"access_denied"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"bogus"}`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	params := auth.OAuth2{
+		ClientID:                    "bogus",
+		DeviceAuthorizationEndpoint: ts.URL + "/device",
+		TokenEndpoint:               ts.URL + "/token",
+		Scopes:                      []string{"accounting"},
+	}
+
+	dc, err := params.RequestDeviceCode(auth.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, &auth.DeviceCode{
+		DeviceCode:      "dc",
+		UserCode:        "ABCD-EFGH",
+		VerificationURI: "https://example.com/device",
+		ExpiresIn:       10 * time.Minute,
+		Interval:        time.Second,
+	}, dc)
+
+	// Speed things up
+	dc.Interval = time.Millisecond
+
+	t.Run("Approved", func(t *testing.T) {
+		polls = 0
+		ret, err := params.PollDeviceToken(context.Background(), dc, auth.Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "bogus", ret.AccessToken)
+		assert.Equal(t, 3, polls)
+	})
+
+	t.Run("Denied", func(t *testing.T) {
+		polls = 0
+		outcome = "denied"
+		_, err := params.PollDeviceToken(context.Background(), dc, auth.Options{})
+		var e *types.ErrorResponse
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, types.ErrAccessDenied, e.ID)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		polls = -1000
+		expiring := *dc
+		expiring.ExpiresIn = 20 * time.Millisecond
+		_, err := params.PollDeviceToken(context.Background(), &expiring, auth.Options{})
+		var e *types.ErrorResponse
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, types.ErrExpiredToken, e.ID)
+	})
+}
@@ -0,0 +1,334 @@
+// Package oauth1 implements the client side of OAuth 1.0a (RFC 5849): request
+// signing and the request token, authorization and access token flow.
+package oauth1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/9spokes/go/crypto"
+	Http "github.com/9spokes/go/http/v2"
+	"github.com/9spokes/go/misc"
+)
+
+// Supported signature methods
+const (
+	HMACSHA1 = "HMAC-SHA1"
+	RSASHA1  = "RSA-SHA1"
+)
+
+// Replaced in tests to produce predictable signatures
+var (
+	nonce = misc.GenerateNonce
+	now   = time.Now
+)
+
+// Config holds the client credentials and endpoints of an OAuth 1.0a
+// provider.
+type Config struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	// Path of the PEM encoded PKCS #1 private key used with RSA-SHA1
+	PrivateKeyFile string
+	// HMAC-SHA1 if not set
+	SignatureMethod string
+	// Where the user-agent is sent back after authorizing the request token,
+	// "oob" if not set
+	Callback string
+
+	RequestTokenURL string
+	AuthorizeURL    string
+	AccessTokenURL  string
+
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
+}
+
+// Token is a request token or an access token with its secret.
+type Token struct {
+	Token  string
+	Secret string
+	// Any other parameter returned by the provider along with the token
+	Extra map[string]string
+}
+
+// Authorization returns the value of the Authorization header for a request.
+// The form is the form encoded body of the request, if any, which is part of
+// the signature. The token is nil when requesting a request token.
+func (c Config) Authorization(method, rawURL string, form url.Values, token *Token) (string, error) {
+	return c.authorization(method, rawURL, form, token, nil)
+}
+
+func (c Config) authorization(method, rawURL string, form url.Values, token *Token, extra map[string]string) (string, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL '%s': %w", rawURL, err)
+	}
+
+	signatureMethod := c.SignatureMethod
+	if signatureMethod == "" {
+		signatureMethod = HMACSHA1
+	}
+
+	oauth := map[string]string{
+		"oauth_consumer_key":     c.ConsumerKey,
+		"oauth_nonce":            nonce(),
+		"oauth_signature_method": signatureMethod,
+		"oauth_timestamp":        strconv.FormatInt(now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+
+	var tokenSecret string
+	if token != nil {
+		oauth["oauth_token"] = token.Token
+		tokenSecret = token.Secret
+	}
+
+	for k, v := range extra {
+		oauth[k] = v
+	}
+
+	base := baseString(method, u, form, oauth)
+
+	var signature string
+	switch signatureMethod {
+	case HMACSHA1:
+		key := misc.OauthEscape(c.ConsumerSecret) + "&" + misc.OauthEscape(tokenSecret)
+		signature, err = crypto.SignHMAC([]byte(base), key)
+	case RSASHA1:
+		signature, err = crypto.SignRSA([]byte(base), c.PrivateKeyFile)
+	default:
+		return "", fmt.Errorf("unsupported signature method '%s'", signatureMethod)
+	}
+	if err != nil {
+		return "", fmt.Errorf("while signing request: %w", err)
+	}
+
+	oauth["oauth_signature"] = signature
+
+	keys := make([]string, 0, len(oauth))
+	for k := range oauth {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, misc.OauthEscape(k), misc.OauthEscape(oauth[k])))
+	}
+
+	return "OAuth " + strings.Join(parts, ", "), nil
+}
+
+// Builds the signature base string (RFC 5849 section 3.4.1) from the request
+// method, URL, form encoded body and protocol parameters.
+func baseString(method string, u *url.URL, form url.Values, oauth map[string]string) string {
+
+	type param struct{ key, value string }
+	var params []param
+
+	add := func(k, v string) {
+		params = append(params, param{misc.OauthEscape(k), misc.OauthEscape(v)})
+	}
+
+	for k, values := range u.Query() {
+		for _, v := range values {
+			add(k, v)
+		}
+	}
+	for k, values := range form {
+		for _, v := range values {
+			add(k, v)
+		}
+	}
+	for k, v := range oauth {
+		if k == "realm" || k == "oauth_signature" {
+			continue
+		}
+		add(k, v)
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+
+	normalized := make([]string, len(params))
+	for i, p := range params {
+		normalized[i] = p.key + "=" + p.value
+	}
+
+	return strings.ToUpper(method) + "&" +
+		misc.OauthEscape(baseURL(u)) + "&" +
+		misc.OauthEscape(strings.Join(normalized, "&"))
+}
+
+// Returns the base string URI: lower case scheme and host, no default port
+// and no query.
+func baseURL(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return scheme + "://" + host + path
+}
+
+// RequestToken obtains a temporary request token from the provider.
+func (c Config) RequestToken(ctx context.Context) (*Token, error) {
+
+	callback := c.Callback
+	if callback == "" {
+		callback = "oob"
+	}
+
+	token, err := c.tokenRequest(ctx, c.RequestTokenURL, nil, map[string]string{"oauth_callback": callback})
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Extra["oauth_callback_confirmed"] != "true" {
+		return nil, fmt.Errorf("callback not confirmed by the provider")
+	}
+
+	return token, nil
+}
+
+// AuthorizationURL returns the URL where the user-agent is sent to authorize
+// the request token.
+func (c Config) AuthorizationURL(requestToken *Token) (string, error) {
+
+	u, err := url.Parse(c.AuthorizeURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorize URL '%s': %w", c.AuthorizeURL, err)
+	}
+
+	q := u.Query()
+	q.Set("oauth_token", requestToken.Token)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// AccessToken exchanges an authorized request token and the verifier received
+// in the callback for an access token.
+func (c Config) AccessToken(ctx context.Context, requestToken *Token, verifier string) (*Token, error) {
+	return c.tokenRequest(ctx, c.AccessTokenURL, requestToken, map[string]string{"oauth_verifier": verifier})
+}
+
+// Sends a signed POST request to a token endpoint and parses the form encoded
+// response.
+func (c Config) tokenRequest(ctx context.Context, endpoint string, token *Token, extra map[string]string) (*Token, error) {
+
+	authorization, err := c.authorization(http.MethodPost, endpoint, nil, token, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	request := Http.Request{
+		URL:    endpoint,
+		Client: c.Client,
+		Headers: map[string]string{
+			"Authorization": authorization,
+			"Content-Type":  "application/x-www-form-urlencoded",
+		},
+	}
+
+	response, err := request.Post(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("non-OK response: [HTTP %d] %s", response.StatusCode, response.Payload)
+	}
+
+	values, err := url.ParseQuery(string(response.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing response '%s': %w", response.Payload, err)
+	}
+
+	ret := &Token{
+		Token:  values.Get("oauth_token"),
+		Secret: values.Get("oauth_token_secret"),
+		Extra:  make(map[string]string),
+	}
+	if ret.Token == "" {
+		return nil, fmt.Errorf("no token in response: %s", response.Payload)
+	}
+
+	for k := range values {
+		if k != "oauth_token" && k != "oauth_token_secret" {
+			ret.Extra[k] = values.Get(k)
+		}
+	}
+
+	return ret, nil
+}
+
+// Middleware returns an http/v2 middleware signing every request with the
+// access token.
+func (c Config) Middleware(token *Token) Http.MiddlewareFunc {
+	return func(next Http.Middleware) Http.Middleware {
+		return func(ctx context.Context, request *Http.Request) (*Http.Response, error) {
+
+			// The query parameters are added to the URL when the request is
+			// sent but they are part of the signature
+			u, err := url.Parse(request.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid URL '%s': %w", request.URL, err)
+			}
+			q := u.Query()
+			for k, v := range request.Query {
+				q.Add(k, v)
+			}
+			u.RawQuery = q.Encode()
+
+			var form url.Values
+			if strings.HasPrefix(header(request.Headers, "Content-Type"), "application/x-www-form-urlencoded") {
+				form, err = url.ParseQuery(string(request.Body))
+				if err != nil {
+					return nil, fmt.Errorf("invalid form body: %w", err)
+				}
+			}
+
+			authorization, err := c.Authorization(request.Method, u.String(), form, token)
+			if err != nil {
+				return nil, err
+			}
+
+			if request.Headers == nil {
+				request.Headers = make(map[string]string)
+			}
+			request.Headers["Authorization"] = authorization
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// Returns the value of a header regardless of the case of its name.
+func header(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package oauth1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	Http "github.com/9spokes/go/http/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Example from RFC 5849 section 3.4.1.1
+func Test_baseString(t *testing.T) {
+	u, _ := url.Parse("http://EXAMPLE.COM:80/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b")
+	form, _ := url.ParseQuery("c2&a3=2+q")
+
+	got := baseString("post", u, form, map[string]string{
+		"realm":                  "Example",
+		"oauth_consumer_key":     "9djdj82h48djs9d2",
+		"oauth_token":            "kkk9d7dh3k39sjv7",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "137131201",
+		"oauth_nonce":            "7d8f3e4a",
+	})
+
+	assert.Equal(t, "POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_method%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk9d7dh3k39sjv7", got)
+}
+
+// Example from the OAuth Core 1.0 specification, appendix A.5
+func TestAuthorization(t *testing.T) {
+	defer fixed("kllo9940pd9333jh", 1191242096)()
+
+	c := Config{ConsumerKey: "dpf43f3p2l4k3l03", ConsumerSecret: "kd94hf93k423kf44"}
+	token := &Token{Token: "nnch734d00sl2jdk", Secret: "pfkkdhi9sl3r4s00"}
+
+	got, err := c.Authorization("GET", "http://photos.example.net/photos?file=vacation.jpg&size=original", nil, token)
+	require.NoError(t, err)
+	assert.Equal(t, `OAuth oauth_consumer_key="dpf43f3p2l4k3l03", oauth_nonce="kllo9940pd9333jh", oauth_signature="tR3%2BTy81lMeYAr%2FFid0kMTYa%2FWM%3D", oauth_signature_method="HMAC-SHA1", oauth_timestamp="1191242096", oauth_token="nnch734d00sl2jdk", oauth_version="1.0"`, got)
+}
+
+func TestFlow(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/request_token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(r.Header.Get("Authorization"), `oauth_callback="https%3A%2F%2Fexample.com%2Fcallback"`)
+		w.Write([]byte("oauth_token=rt&oauth_token_secret=rts&oauth_callback_confirmed=true"))
+	})
+	mux.HandleFunc("/access_token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(r.Header.Get("Authorization"), `oauth_token="rt"`)
+		assert.Contains(r.Header.Get("Authorization"), `oauth_verifier="verifier"`)
+		w.Write([]byte("oauth_token=at&oauth_token_secret=ats&user_id=123"))
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(strings.HasPrefix(r.Header.Get("Authorization"), "OAuth "))
+		assert.Contains(r.Header.Get("Authorization"), `oauth_token="at"`)
+		w.Write([]byte("{}"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := Config{
+		ConsumerKey:     "key",
+		ConsumerSecret:  "secret",
+		Callback:        "https://example.com/callback",
+		RequestTokenURL: ts.URL + "/request_token",
+		AuthorizeURL:    ts.URL + "/authorize",
+		AccessTokenURL:  ts.URL + "/access_token",
+	}
+
+	requestToken, err := c.RequestToken(context.Background())
+	require.NoError(err)
+	assert.Equal("rt", requestToken.Token)
+	assert.Equal("rts", requestToken.Secret)
+
+	link, err := c.AuthorizationURL(requestToken)
+	require.NoError(err)
+	assert.Equal(ts.URL+"/authorize?oauth_token=rt", link)
+
+	accessToken, err := c.AccessToken(context.Background(), requestToken, "verifier")
+	require.NoError(err)
+	assert.Equal(&Token{Token: "at", Secret: "ats", Extra: map[string]string{"user_id": "123"}}, accessToken)
+
+	request := Http.Request{URL: ts.URL + "/api", Query: map[string]string{"page": "1"}}
+	request.Use(c.Middleware(accessToken))
+	response, err := request.Get(context.Background())
+	require.NoError(err)
+	assert.Equal(http.StatusOK, response.StatusCode)
+}
+
+// Makes the nonce and timestamp predictable, returns a function restoring them.
+func fixed(n string, timestamp int64) func() {
+	oldNonce, oldNow := nonce, now
+	nonce = func() string { return n }
+	now = func() time.Time { return time.Unix(timestamp, 0) }
+	return func() {
+		nonce, now = oldNonce, oldNow
+	}
+}
@@ -13,16 +13,22 @@ import (
 
 // OAuth2 represents the minimum fields required to perform an OAuth2 token exchange or token refresh.
 type OAuth2 struct {
-	Client        *http.Client
-	ClientID      string
-	ClientSecret  string
-	Code          string
-	Extras        map[string]string
-	Headers       map[string]string
-	Method        string
-	RedirectURI   string
-	RefreshToken  string
-	TokenEndpoint string
+	AuthorizationEndpoint       string
+	Client                      *http.Client
+	ClientID                    string
+	ClientSecret                string
+	Code                        string
+	CodeVerifier                string
+	DeviceAuthorizationEndpoint string
+	Extras                      map[string]string
+	Headers                     map[string]string
+	Method                      string
+	Password                    string
+	RedirectURI                 string
+	RefreshToken                string
+	Scopes                      []string
+	TokenEndpoint               string
+	Username                    string
 }
 
 // Options are a set of flags & modifiers to the OAuth2 implementation
@@ -32,6 +38,12 @@ type Options struct {
 	IncludeResponseCookies bool `default:"false"`
 }
 
+// Sends a request to the token endpoint and returns the parsed response.
+//
+// A 429 response returns an ErrorResponse whose ID is types.ErrTooManyRequests.
+// Otherwise, when the endpoint returns a standard OAuth2 error, the ID is the
+// error code of the response, e.g. invalid_grant, and types.ErrError for the
+// other failed requests.
 func (params OAuth2) oauthRequest(opt Options, data url.Values) (map[string]interface{}, error) {
 	if params.ClientID == "" {
 		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingClientID, Message: "client_id cannot be empty"}
@@ -99,62 +111,112 @@ func (params OAuth2) oauthRequest(opt Options, data url.Values) (map[string]inte
 	}
 	if err != nil {
 		var code int
+		// Transport errors and server errors may go away on their own
+		severity := types.ErrSeverityWarn
 		if response != nil {
 			code = response.StatusCode
+			if code < http.StatusInternalServerError {
+				severity = types.ErrSeverityFatal
+			}
+
+			if code == http.StatusTooManyRequests {
+				return nil, &types.ErrorResponse{HTTPStatus: code, ID: types.ErrTooManyRequests, Message: throttler.ErrTooManyRequests.Error(), Severity: types.ErrSeverityWarn}
+			}
+
+			if e := oauthError(code, parseBody(response)); e != nil {
+				return nil, e
+			}
 		}
 		return nil, &types.ErrorResponse{
 			ID:         types.ErrError,
 			Message:    fmt.Sprintf("error while connecting to %s: %s", params.TokenEndpoint, err.Error()),
 			HTTPStatus: code,
-			Severity:   types.ErrSeverityFatal,
+			Severity:   severity,
 		}
 	}
 
-	if response.StatusCode == http.StatusTooManyRequests {
-		return nil, &types.ErrorResponse{HTTPStatus: response.StatusCode, ID: types.ErrTooManyRequests, Message: throttler.ErrTooManyRequests.Error()}
-	}
-
 	if response.Headers["Content-Type"] == nil {
 		return nil, &types.ErrorResponse{HTTPStatus: response.StatusCode, ID: types.ErrMissingContentTypeHeader, Message: fmt.Sprintf("content-type header missing in response: %s", response.Body)}
 	}
 
 	contentType := response.Headers["Content-Type"][0]
 
-	var ret map[string]interface{}
-
 	if strings.Contains(contentType, "application/json") {
-		parsed, ok := response.JSON.(map[string]interface{})
-		if !ok {
+		if _, ok := response.JSON.(map[string]interface{}); !ok {
 			return nil, &types.ErrorResponse{HTTPStatus: response.StatusCode, ID: types.ErrDeserialiseFailed, Message: fmt.Sprintf("failed to deserialise the response: %s", response.Body)}
 		}
+	}
 
-		ret = parsed
+	ret := parseBody(response)
+	if ret == nil {
+		return nil, &types.ErrorResponse{HTTPStatus: response.StatusCode, ID: types.ErrResponseFormatUnknown, Message: "could not determine content type encoding from response"}
+	}
+
+	// Some providers report errors with a 200 response
+	if e := oauthError(response.StatusCode, ret); e != nil {
+		return nil, e
+	}
+
+	if opt.IncludeResponseCookies {
+		for _, cookie := range response.Cookies {
+			ret[cookie.Name] = cookie.Value
+		}
+	}
+
+	return ret, nil
+}
+
+// Parses a JSON or form encoded token endpoint response. Returns nil if the
+// content type is not supported or the response cannot be parsed.
+func parseBody(response *Http.Response) map[string]interface{} {
+
+	var contentType string
+	if ct := response.Headers["Content-Type"]; len(ct) > 0 {
+		contentType = ct[0]
+	}
+
+	if strings.Contains(contentType, "application/json") {
+		parsed, _ := response.JSON.(map[string]interface{})
+		return parsed
 	}
 
 	if strings.Contains(contentType, "application/x-www-form-urlencoded") || strings.Contains(contentType, "text/html") {
 
 		m, _ := url.ParseQuery(string(response.Body))
-		ret = make(map[string]interface{})
+		ret := make(map[string]interface{})
 		for k, v := range m {
 			ret[k] = v[0]
 		}
+		return ret
 	}
 
-	if ret == nil {
-		return nil, &types.ErrorResponse{HTTPStatus: response.StatusCode, ID: types.ErrResponseFormatUnknown, Message: "could not determine content type encoding from response"}
+	return nil
+}
+
+// Returns the standard OAuth2 error (RFC 6749 section 5.2) held in a token
+// endpoint response, or nil if the response is not an error.
+func oauthError(status int, ret map[string]interface{}) *types.ErrorResponse {
+
+	code, _ := ret["error"].(string)
+	if code == "" {
+		return nil
 	}
 
-	if opt.IncludeResponseCookies {
-		for _, cookie := range response.Cookies {
-			ret[cookie.Name] = cookie.Value
-		}
+	message, _ := ret["error_description"].(string)
+	if message == "" {
+		message = "error returned by the token endpoint"
 	}
 
-	return ret, nil
+	return &types.ErrorResponse{
+		ID:         code,
+		Message:    message,
+		HTTPStatus: status,
+		Severity:   types.OAuth2ErrorSeverity(code),
+	}
 }
 
 // Authorize implements an OAuth2 authorization using the parameters defined in the OAuth2 struct
-func (params OAuth2) Authorize(opt Options) (map[string]interface{}, error) {
+func (params OAuth2) Authorize(opt Options) (*Token, error) {
 
 	if params.Code == "" {
 		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingAuthorizationCode, Message: "the authorization code is missing"}
@@ -166,15 +228,19 @@ func (params OAuth2) Authorize(opt Options) (map[string]interface{}, error) {
 		"redirect_uri": {params.RedirectURI},
 	}
 
+	if params.CodeVerifier != "" {
+		data.Set("code_verifier", params.CodeVerifier)
+	}
+
 	for k, v := range params.Extras {
 		data.Set(k, v)
 	}
 
-	return params.oauthRequest(opt, data)
+	return params.token(opt, data)
 }
 
 // Refresh implements an OAuth2 token refresh methods.  Parameters are sent via the OAuth2 struct
-func (params OAuth2) Refresh(opt Options) (map[string]interface{}, *types.ErrorResponse) {
+func (params OAuth2) Refresh(opt Options) (*Token, *types.ErrorResponse) {
 
 	if params.RefreshToken == "" {
 		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingRefreshToken, Message: fmt.Sprintf("the refresh token is missing")}
@@ -187,7 +253,58 @@ func (params OAuth2) Refresh(opt Options) (map[string]interface{}, *types.ErrorR
 
 	res, err := params.oauthRequest(opt, data)
 	if err != nil {
-		return res, err.(*types.ErrorResponse)
+		return nil, err.(*types.ErrorResponse)
+	}
+	return newToken(res), nil
+}
+
+// ClientCredentials implements the OAuth2 client credentials grant, used to
+// obtain an access token on behalf of the client itself.
+func (params OAuth2) ClientCredentials(opt Options) (*Token, error) {
+
+	data := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+
+	params.setScopeAndExtras(data)
+
+	return params.token(opt, data)
+}
+
+// PasswordCredentials implements the OAuth2 resource owner password
+// credentials grant using the Username and Password fields.
+func (params OAuth2) PasswordCredentials(opt Options) (*Token, error) {
+
+	if params.Username == "" {
+		return nil, &types.ErrorResponse{Severity: types.ErrSeverityFatal, ID: types.ErrMissingUsername, Message: "the username is missing"}
+	}
+
+	data := url.Values{
+		"grant_type": {"password"},
+		"username":   {params.Username},
+		"password":   {params.Password},
+	}
+
+	params.setScopeAndExtras(data)
+
+	return params.token(opt, data)
+}
+
+// Sends a token request and parses the response into a Token.
+func (params OAuth2) token(opt Options, data url.Values) (*Token, error) {
+	ret, err := params.oauthRequest(opt, data)
+	if err != nil {
+		return nil, err
+	}
+	return newToken(ret), nil
+}
+
+func (params OAuth2) setScopeAndExtras(data url.Values) {
+	if len(params.Scopes) > 0 {
+		data.Set("scope", strings.Join(params.Scopes, " "))
+	}
+
+	for k, v := range params.Extras {
+		data.Set(k, v)
 	}
-	return res, nil
 }
@@ -140,9 +140,9 @@ func TestAuthorize(t *testing.T) {
 
 			var data url.Values
 			if tt.options.DataInQuery {
-				data, _ = url.ParseQuery(ret["query"].(string))
+				data, _ = url.ParseQuery(ret.Extra["query"].(string))
 			} else {
-				data, _ = url.ParseQuery(ret["body"].(string))
+				data, _ = url.ParseQuery(ret.Extra["body"].(string))
 
 				if !tt.options.AuthInHeader {
 					assert.Equal(tt.ctx.ClientSecret, data.Get("client_secret"), "incorrect client_secret sent as auth")
@@ -161,7 +161,7 @@ func TestAuthorize(t *testing.T) {
 			
 
 			if tt.options.AuthInHeader {
-				authHeader, ok := ret["auth"].(string)
+				authHeader, ok := ret.Extra["auth"].(string)
 				require.True(ok, "Authorization header must be string")
 				require.NotEmpty(authHeader, "Authorization header")
 
@@ -301,9 +301,9 @@ func TestRefresh(t *testing.T) {
 
 			var data url.Values
 			if tt.options.DataInQuery {
-				data, _ = url.ParseQuery(ret["query"].(string))
+				data, _ = url.ParseQuery(ret.Extra["query"].(string))
 			} else {
-				data, _ = url.ParseQuery(ret["body"].(string))
+				data, _ = url.ParseQuery(ret.Extra["body"].(string))
 
 				if !tt.options.AuthInHeader {
 					wantClientSecret := tt.ctx.ClientSecret
@@ -327,7 +327,7 @@ func TestRefresh(t *testing.T) {
 			}
 
 			if tt.options.AuthInHeader {
-				if authHeader, _ := ret["auth"].(string); authHeader == "" {
+				if authHeader, _ := ret.Extra["auth"].(string); authHeader == "" {
 					t.Errorf("Authorization header not set")
 				} else {
 					if !strings.HasPrefix(authHeader, "Basic ") {
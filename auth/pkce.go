@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// PKCE holds a Proof Key for Code Exchange (RFC 7636). The challenge and
+// method are sent with the authorization request and the verifier is sent,
+// through the OAuth2 CodeVerifier field, when the code is exchanged.
+type PKCE struct {
+	Verifier  string
+	Challenge string
+	Method    string
+}
+
+// GeneratePKCE creates a new random code verifier and its S256 challenge.
+func GeneratePKCE() (*PKCE, error) {
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("while generating code verifier: %w", err)
+	}
+
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(verifier))
+
+	return &PKCE{
+		Verifier:  verifier,
+		Challenge: base64.RawURLEncoding.EncodeToString(hash[:]),
+		Method:    "S256",
+	}, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token is the response of an OAuth2 token endpoint.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	// Computed from expires_in when the token was received, zero if the token
+	// endpoint did not say when the access token expires.
+	Expiry  time.Time
+	Scope   string
+	IDToken string
+	// Any other attribute returned by the token endpoint, as well as the
+	// response cookies when Options.IncludeResponseCookies is set.
+	Extra map[string]interface{}
+}
+
+// Valid returns true if the token has an access token which has not expired.
+func (t *Token) Valid() bool {
+	return t != nil && t.AccessToken != "" && !t.ExpiresWithin(0)
+}
+
+// ExpiresWithin returns true if the access token expires within the specified
+// duration. Tokens without an expiry never expire.
+func (t *Token) ExpiresWithin(d time.Duration) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return !time.Now().Add(d).Before(t.Expiry)
+}
+
+// Builds a Token from the parsed response of a token endpoint.
+func newToken(ret map[string]interface{}) *Token {
+
+	token := &Token{Extra: make(map[string]interface{})}
+
+	for k, v := range ret {
+		switch k {
+		case "access_token":
+			token.AccessToken = stringValue(v)
+		case "refresh_token":
+			token.RefreshToken = stringValue(v)
+		case "token_type":
+			token.TokenType = stringValue(v)
+		case "scope":
+			token.Scope = stringValue(v)
+		case "id_token":
+			token.IDToken = stringValue(v)
+		case "expires_in":
+			if seconds := intValue(v); seconds > 0 {
+				token.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		default:
+			token.Extra[k] = v
+		}
+	}
+
+	return token
+}
+
+func stringValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Returns the integer value of a JSON number or of a string, as returned in
+// form encoded responses and by some non-compliant providers.
+func intValue(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9spokes/go/auth"
+	"github.com/9spokes/go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "JSON",
+			contentType: "application/json",
+			body:        `{"access_token":"at","refresh_token":"rt","token_type":"Bearer","expires_in":3600,"scope":"read","id_token":"it","realm_id":"123"}`,
+		},
+		{
+			name:        "JSON with expires_in as a string",
+			contentType: "application/json",
+			body:        `{"access_token":"at","refresh_token":"rt","token_type":"Bearer","expires_in":"3600","scope":"read","id_token":"it","realm_id":"123"}`,
+		},
+		{
+			name:        "Form encoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "access_token=at&refresh_token=rt&token_type=Bearer&expires_in=3600&scope=read&id_token=it&realm_id=123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			token, err := auth.OAuth2{TokenEndpoint: ts.URL, ClientID: "bogus", RefreshToken: "bogus"}.Refresh(auth.Options{})
+			require.Nil(err)
+
+			assert.Equal("at", token.AccessToken)
+			assert.Equal("rt", token.RefreshToken)
+			assert.Equal("Bearer", token.TokenType)
+			assert.Equal("read", token.Scope)
+			assert.Equal("it", token.IDToken)
+			assert.Equal(map[string]interface{}{"realm_id": "123"}, token.Extra)
+			assert.WithinDuration(time.Now().Add(time.Hour), token.Expiry, 5*time.Second)
+
+			assert.True(token.Valid())
+			assert.False(token.ExpiresWithin(time.Minute))
+			assert.True(token.ExpiresWithin(2 * time.Hour))
+		})
+	}
+}
+
+func TestTokenValid(t *testing.T) {
+	assert.False(t, (*auth.Token)(nil).Valid())
+	assert.False(t, (&auth.Token{}).Valid())
+	assert.True(t, (&auth.Token{AccessToken: "at"}).Valid(), "tokens without an expiry never expire")
+	assert.False(t, (&auth.Token{AccessToken: "at", Expiry: time.Now().Add(-time.Second)}).Valid())
+}
+
+func TestOAuth2Errors(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		status        int
+		contentType   string
+		body          string
+		wantID        string
+		wantSeverity  string
+		wantRevoked   bool
+		wantTransient bool
+		// Closes the server before the request
+		unreachable bool
+	}{
+		{
+			name:         "Revoked consent",
+			status:       400,
+			contentType:  "application/json",
+			body:         `{"error":"invalid_grant","error_description":"refresh token revoked"}`,
+			wantID:       types.ErrInvalidGrant,
+			wantSeverity: types.ErrSeverityFatal,
+			wantRevoked:  true,
+		},
+		{
+			name:          "Form encoded transient error",
+			status:        503,
+			contentType:   "application/x-www-form-urlencoded",
+			body:          "error=temporarily_unavailable",
+			wantID:        types.ErrTemporarilyUnavailable,
+			wantSeverity:  types.ErrSeverityWarn,
+			wantTransient: true,
+		},
+		{
+			name:         "Error with a 200 response",
+			status:       200,
+			contentType:  "application/json",
+			body:         `{"error":"invalid_request"}`,
+			wantID:       types.ErrInvalidRequest,
+			wantSeverity: types.ErrSeverityError,
+		},
+		{
+			name:          "Rate limited",
+			status:        429,
+			contentType:   "application/json",
+			body:          `{}`,
+			wantID:        types.ErrTooManyRequests,
+			wantSeverity:  types.ErrSeverityWarn,
+			wantTransient: true,
+		},
+		{
+			name:          "Server error without body",
+			status:        503,
+			contentType:   "text/plain",
+			wantID:        types.ErrError,
+			wantSeverity:  types.ErrSeverityWarn,
+			wantTransient: true,
+		},
+		{
+			name:         "Client error without body",
+			status:       400,
+			contentType:  "text/plain",
+			wantID:       types.ErrError,
+			wantSeverity: types.ErrSeverityFatal,
+		},
+		{
+			name:         "Connection refused",
+			unreachable:  true,
+			wantID:       types.ErrError,
+			wantSeverity: types.ErrSeverityWarn,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			if tt.unreachable {
+				ts.Close()
+			}
+
+			_, err := auth.OAuth2{TokenEndpoint: ts.URL, ClientID: "bogus", RefreshToken: "bogus"}.Refresh(auth.Options{})
+			require.NotNil(err)
+
+			assert.Equal(tt.wantID, err.ID)
+			assert.Equal(tt.wantSeverity, err.Severity)
+			assert.Equal(tt.wantSeverity == types.ErrSeverityFatal, err.IsFatal())
+			assert.Equal(tt.status, err.HTTPStatus)
+			assert.Equal(tt.wantRevoked, err.IsRevoked())
+			assert.Equal(tt.wantTransient, err.IsTransient())
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mergermarket/go-pkcs7"
+)
+
+const (
+	// Prefix of the payloads produced by GenerateCallbackURLV2
+	callbackV2Prefix = "v2."
+	// Maximum age of the payloads when CallbackOptions.MaxAge is not set
+	defaultCallbackMaxAge = 10 * time.Minute
+)
+
+// ErrCallbackReplayed is returned by the replay checks of ParseCallbackURL
+// when a payload has already been used.
+var ErrCallbackReplayed = errors.New("callback payload has already been used")
+
+// CallbackPayload is the decrypted payload of a callback URL.
+type CallbackPayload struct {
+	URL      string
+	Callback string
+	// Zero if the payload was generated without timeout
+	Timestamp time.Time
+	// Unique ID of the version 2 payloads, empty for the legacy ones
+	ID string
+}
+
+// CallbackOptions holds the checks performed by ParseCallbackURL.
+type CallbackOptions struct {
+	// Maximum age of the payload, 10 minutes if not set. Payloads without
+	// timestamp are rejected.
+	MaxAge time.Duration
+	// Allowed clock skew for payloads generated in the future
+	Leeway time.Duration
+	// Callbacks the payload may redirect to, as URL prefixes such as
+	// https://app.9spokes.io/oauth. Required.
+	AllowedCallbacks []string
+	// Accept the legacy AES-CBC payloads generated with a timeout, which can
+	// be forged and replayed
+	AllowLegacy bool
+	// Optional hook rejecting replayed version 2 payloads, typically by
+	// storing their ID until they expire and returning ErrCallbackReplayed
+	// when it is already stored.
+	CheckReplay func(id string, expires time.Time) error
+}
+
+type callbackPayload struct {
+	URL       string `json:"url"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Callback  string `json:"callback"`
+	ID        string `json:"id,omitempty"`
+}
+
+// GenerateCallbackURLV2 is the successor of GenerateCallbackURL. The payload
+// is encrypted with AES-GCM and a random nonce, so it cannot be forged, and it
+// has a timestamp and a unique ID so it can be expired and checked for replay
+// by ParseCallbackURL.
+func GenerateCallbackURLV2(url, callback, secret string) (string, error) {
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	unencrypted, err := json.Marshal(callbackPayload{
+		URL:       url,
+		Callback:  callback,
+		Timestamp: time.Now().UnixNano() / 1e6,
+		ID:        hex.EncodeToString(id),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(key, nonce, unencrypted, []byte(callbackV2Prefix))
+	if err != nil {
+		return "", err
+	}
+
+	return callbackV2Prefix + base64.RawURLEncoding.EncodeToString(append(nonce, sealed...)), nil
+}
+
+// ParseCallbackURL decrypts a payload produced by GenerateCallbackURLV2, or by
+// GenerateCallbackURL with the iv if AllowLegacy is set, and checks its age,
+// callback and replay as set in the options.
+func ParseCallbackURL(encrypted, secret, iv string, opts CallbackOptions) (*CallbackPayload, error) {
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("while decoding secret: %s", err.Error())
+	}
+
+	if opts.MaxAge == 0 {
+		opts.MaxAge = defaultCallbackMaxAge
+	}
+
+	var body callbackPayload
+
+	if strings.HasPrefix(encrypted, callbackV2Prefix) {
+		err = decryptCallbackV2(strings.TrimPrefix(encrypted, callbackV2Prefix), key, &body)
+	} else if opts.AllowLegacy {
+		err = decryptCallbackV1(encrypted, key, iv, &body)
+	} else {
+		return nil, fmt.Errorf("legacy callback payloads are not accepted")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &CallbackPayload{
+		URL:      body.URL,
+		Callback: body.Callback,
+		ID:       body.ID,
+	}
+	if body.Timestamp != 0 {
+		payload.Timestamp = time.Unix(0, body.Timestamp*int64(time.Millisecond))
+	}
+
+	if err := checkCallbackAge(payload.Timestamp, opts); err != nil {
+		return nil, err
+	}
+
+	if !callbackAllowed(payload.Callback, opts.AllowedCallbacks) {
+		return nil, fmt.Errorf("callback '%s' is not allowed", payload.Callback)
+	}
+
+	if opts.CheckReplay != nil && payload.ID != "" {
+		expires := payload.Timestamp.Add(opts.MaxAge + opts.Leeway)
+		if err := opts.CheckReplay(payload.ID, expires); err != nil {
+			return nil, err
+		}
+	}
+
+	return payload, nil
+}
+
+func decryptCallbackV2(encrypted string, key []byte, body *callbackPayload) error {
+
+	data, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return fmt.Errorf("while decoding callback payload: %s", err.Error())
+	}
+
+	if len(data) < nonceSize+tagSize {
+		return ErrInvalidCiphertext
+	}
+
+	plaintext, err := open(key, data[:nonceSize], data[nonceSize:], []byte(callbackV2Prefix))
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(plaintext, body); err != nil {
+		return fmt.Errorf("while unmarshalling callback payload: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Decrypts a payload produced by GenerateCallbackURL with AES-CBC and a static
+// IV
+func decryptCallbackV1(encrypted string, key []byte, iv string, body *callbackPayload) error {
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return fmt.Errorf("while decoding callback payload: %s", err.Error())
+	}
+
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(ivBytes) != aes.BlockSize {
+		return fmt.Errorf("invalid IV")
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return ErrInvalidCiphertext
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, ivBytes).CryptBlocks(plaintext, data)
+
+	plaintext, err = pkcs7.Unpad(plaintext, aes.BlockSize)
+	if err != nil {
+		return ErrInvalidCiphertext
+	}
+
+	if err := json.Unmarshal(plaintext, body); err != nil {
+		return fmt.Errorf("while unmarshalling callback payload: %s", err.Error())
+	}
+
+	return nil
+}
+
+func checkCallbackAge(timestamp time.Time, opts CallbackOptions) error {
+
+	if timestamp.IsZero() {
+		return fmt.Errorf("callback payload has no timestamp")
+	}
+
+	now := time.Now()
+	if timestamp.After(now.Add(opts.Leeway)) {
+		return fmt.Errorf("callback payload was generated in the future")
+	}
+	if now.Sub(timestamp) > opts.MaxAge+opts.Leeway {
+		return fmt.Errorf("callback payload has expired")
+	}
+
+	return nil
+}
+
+// Checks whether the callback has the scheme and host of one of the allowed
+// callbacks, and its cleaned path is the path of the allowed callback or below
+// it, so dot segments cannot escape the allowed path
+func callbackAllowed(callback string, allowed []string) bool {
+
+	target, err := url.Parse(callback)
+	if err != nil || target.Host == "" {
+		return false
+	}
+
+	targetPath := path.Clean("/" + target.Path)
+
+	for _, a := range allowed {
+		prefix, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+
+		if !strings.EqualFold(target.Scheme, prefix.Scheme) || !strings.EqualFold(target.Host, prefix.Host) {
+			continue
+		}
+
+		prefixPath := path.Clean("/" + prefix.Path)
+		if targetPath == prefixPath || strings.HasPrefix(targetPath, strings.TrimSuffix(prefixPath, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
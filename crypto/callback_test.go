@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCallbackURL(t *testing.T) {
+
+	secret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	iv := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+	allowed := []string{"https://app.9spokes.io/oauth"}
+
+	v2, err := GenerateCallbackURLV2("https://osp/authorize", "https://app.9spokes.io/oauth/callback", secret)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(v2, "v2."))
+
+	legacy, err := GenerateCallbackURL("https://osp/authorize", "https://app.9spokes.io/oauth/callback", secret, iv, true)
+	require.NoError(t, err)
+
+	legacyWithoutTimeout, err := GenerateCallbackURL("https://osp/authorize", "https://app.9spokes.io/oauth/callback", secret, iv, false)
+	require.NoError(t, err)
+
+	forbidden, err := GenerateCallbackURLV2("https://osp/authorize", "https://evil.io/oauth/callback", secret)
+	require.NoError(t, err)
+
+	// Generated an hour ago
+	expired := func() string {
+		body, _ := json.Marshal(callbackPayload{URL: "https://osp/authorize", Callback: "https://app.9spokes.io/oauth/callback", Timestamp: time.Now().Add(-time.Hour).UnixNano() / 1e6, ID: "1"})
+		key, _ := base64.StdEncoding.DecodeString(secret)
+		nonce := make([]byte, nonceSize)
+		sealed, err := seal(key, nonce, body, []byte(callbackV2Prefix))
+		require.NoError(t, err)
+		return callbackV2Prefix + base64.RawURLEncoding.EncodeToString(append(nonce, sealed...))
+	}()
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(v2, callbackV2Prefix))
+	require.NoError(t, err)
+	data[len(data)-1] ^= 1
+	tampered := callbackV2Prefix + base64.RawURLEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name      string
+		encrypted string
+		opts      CallbackOptions
+		err       string
+	}{
+		{name: "Version 2", encrypted: v2, opts: CallbackOptions{MaxAge: time.Minute, AllowedCallbacks: allowed}},
+		{name: "Default max age", encrypted: v2, opts: CallbackOptions{AllowedCallbacks: allowed}},
+		{name: "Legacy", encrypted: legacy, opts: CallbackOptions{MaxAge: time.Minute, AllowedCallbacks: allowed, AllowLegacy: true}},
+		{name: "Legacy without timestamp", encrypted: legacyWithoutTimeout, opts: CallbackOptions{AllowedCallbacks: allowed, AllowLegacy: true}, err: "no timestamp"},
+		{name: "Legacy not allowed", encrypted: legacy, opts: CallbackOptions{AllowedCallbacks: allowed}, err: "not accepted"},
+		{name: "Expired", encrypted: expired, opts: CallbackOptions{MaxAge: time.Minute, AllowedCallbacks: allowed}, err: "expired"},
+		{name: "Expired with default max age", encrypted: expired, opts: CallbackOptions{AllowedCallbacks: allowed}, err: "expired"},
+		{name: "Tampered", encrypted: tampered, opts: CallbackOptions{AllowedCallbacks: allowed}, err: "invalid ciphertext"},
+		{name: "Callback not allowed", encrypted: forbidden, opts: CallbackOptions{AllowedCallbacks: allowed}, err: "not allowed"},
+		{name: "Callback outside of the path", encrypted: v2, opts: CallbackOptions{AllowedCallbacks: []string{"https://app.9spokes.io/oauth/other"}}, err: "not allowed"},
+		{name: "No allowed callbacks", encrypted: v2, err: "not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := ParseCallbackURL(tt.encrypted, secret, iv, tt.opts)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "https://osp/authorize", payload.URL)
+			assert.Equal(t, "https://app.9spokes.io/oauth/callback", payload.Callback)
+		})
+	}
+}
+
+func TestParseCallbackURLReplay(t *testing.T) {
+
+	secret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	encrypted, err := GenerateCallbackURLV2("https://osp/authorize", "https://app.9spokes.io/oauth/callback", secret)
+	require.NoError(t, err)
+
+	seen := map[string]time.Time{}
+	opts := CallbackOptions{
+		MaxAge:           time.Minute,
+		AllowedCallbacks: []string{"https://app.9spokes.io/"},
+		CheckReplay: func(id string, expires time.Time) error {
+			if _, ok := seen[id]; ok {
+				return ErrCallbackReplayed
+			}
+			seen[id] = expires
+			return nil
+		},
+	}
+
+	payload, err := ParseCallbackURL(encrypted, secret, "", opts)
+	require.NoError(t, err)
+	assert.NotEmpty(t, payload.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), seen[payload.ID], time.Second)
+
+	_, err = ParseCallbackURL(encrypted, secret, "", opts)
+	assert.ErrorIs(t, err, ErrCallbackReplayed)
+}
+
+func Test_callbackAllowed(t *testing.T) {
+
+	allowed := []string{"https://app.9spokes.io/oauth", "https://other.9spokes.io/"}
+
+	tests := []struct {
+		callback string
+		want     bool
+	}{
+		{callback: "https://app.9spokes.io/oauth", want: true},
+		{callback: "https://app.9spokes.io/oauth/callback", want: true},
+		{callback: "https://APP.9spokes.io/oauth/callback", want: true},
+		{callback: "https://other.9spokes.io/anything", want: true},
+		{callback: "https://other.9spokes.io", want: true},
+		{callback: "https://app.9spokes.io/oauth/../admin", want: false},
+		{callback: "https://app.9spokes.io/oauth/%2e%2e/admin", want: false},
+		{callback: "https://app.9spokes.io/oauthx", want: false},
+		{callback: "https://app.9spokes.io/", want: false},
+		{callback: "http://app.9spokes.io/oauth/callback", want: false},
+		{callback: "https://evil.io/oauth/callback", want: false},
+		{callback: "/oauth/callback", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, callbackAllowed(tt.callback, allowed), tt.callback)
+	}
+}
@@ -1,7 +1,6 @@
 package crypto
 
 import (
-	"bytes"
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
@@ -15,96 +14,24 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/url"
 	"time"
 
 	"github.com/mergermarket/go-pkcs7"
-	"golang.org/x/crypto/pbkdf2"
 )
 
-// Decrypt uses a PBKDF2 key encryption method with a AES-CBC 256 algorithm
+// Decrypt decrypts a ciphertext produced by Encrypt. Ciphertexts produced by
+// previous versions, using AES-CBC 256 without authentication, are detected
+// and still decrypted.
 func Decrypt(ciphertext []byte, secret []byte) (string, error) {
-
-	ciphertext = ciphertext[4:]
-
-	if len(ciphertext) < aes.BlockSize {
-		return "", errors.New("ciphertext too short")
-	}
-
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-
-	if len(ciphertext)%aes.BlockSize != 0 {
-		return "", errors.New("ciphertext is not a multiple of the block size")
-	}
-
-	key := pbkdf2.Key(secret, iv, 2048, 32, sha256.New)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(ciphertext, ciphertext)
-
-	unpadded, err := func(b []byte, blocksize int) ([]byte, error) {
-
-		if len(b)%blocksize != 0 {
-			return nil, errors.New("Invalid PKCS7 padding size")
-		}
-		c := b[len(b)-1]
-		n := int(c)
-		if n == 0 || n > len(b) {
-			return nil, errors.New("Invalid PKCS7 padding size")
-		}
-		for i := 0; i < n; i++ {
-			if b[len(b)-n+i] != c {
-				return nil, errors.New("Invalid PKCS7 padding size")
-			}
-		}
-		return b[:len(b)-n], nil
-	}(ciphertext, aes.BlockSize)
-
-	return string(unpadded), err
-
+	return DecryptWithAD(ciphertext, secret, nil)
 }
 
-// Encrypt uses a PBKDF2 key encryption method with a AES-CBC 256 algorithm
+// Encrypt uses a PBKDF2 key encryption method with a AES-GCM 256 algorithm,
+// see EncryptWithAD
 func Encrypt(str string, secret []byte) ([]byte, error) {
-
-	header := make([]byte, 4+aes.BlockSize)
-
-	if _, err := io.ReadFull(rand.Reader, header); err != nil {
-		return nil, err
-	}
-
-	iv := header[4:]
-
-	bytes := func(b []byte, blocksize int) []byte {
-		n := blocksize - (len(b) % blocksize)
-		pb := make([]byte, len(b)+n)
-		copy(pb, b)
-		copy(pb[len(b):], bytes.Repeat([]byte{byte(n)}, n))
-		return pb
-	}([]byte(str), aes.BlockSize)
-
-	key := pbkdf2.Key(secret, iv, 2048, 32, sha256.New)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	ciphertext := make([]byte, len(header)+len(bytes))
-	copy(ciphertext, header)
-
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ciphertext[len(header):], bytes)
-
-	return ciphertext, nil
+	return EncryptWithAD(str, secret, nil)
 }
 
 // SignRSA creates the signature for oauth1 with rsa-sha1
@@ -141,6 +68,7 @@ func SignHMAC(message []byte, key string) (string, error) {
 
 // GenerateCallbackURL is used to generate an encrypted URL where a user-agent can be directed.
 // It leverages the cb.9spokes.io/redirect callback handler which is used to decouple environments from callback URLs
+// New callbacks should use GenerateCallbackURLV2, whose payloads cannot be forged or replayed
 func GenerateCallbackURL(url, callback, secret, iv string, timeout bool) (string, error) {
 
 	type payload struct {
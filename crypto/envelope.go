@@ -0,0 +1,315 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Versions of the ciphertexts, stored in their first byte
+const (
+	versionLegacy   byte = 0
+	versionPBKDF2   byte = 1
+	versionProvider byte = 2
+	versionKeyring  byte = 3
+)
+
+// Key derivation functions of the version 1 and 3 ciphertexts
+const (
+	kdfPBKDF2SHA256 byte = 1
+)
+
+const (
+	keySize   = 32
+	saltSize  = 16
+	nonceSize = 12
+	tagSize   = 16
+
+	// KDF, iterations, salt and nonce
+	pbkdf2ParamsSize = 1 + 4 + saltSize + nonceSize
+
+	minIterations = 1000
+	maxIterations = 10000000
+
+	// 4 random bytes and the IV of the ciphertexts produced by the previous
+	// versions of Encrypt
+	legacyHeaderSize = 4 + aes.BlockSize
+)
+
+// DefaultIterations is the number of PBKDF2 iterations used to derive the key
+// of new ciphertexts. It is stored in each ciphertext, so changing it does not
+// affect the existing ones.
+var DefaultIterations = 100000
+
+// ErrInvalidCiphertext is returned when a ciphertext is malformed, has been
+// tampered with or was encrypted with another secret or additional data.
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// EncryptWithAD encrypts the string with AES-GCM 256 using a key derived from
+// the secret with PBKDF2-SHA256 and a random salt. The additional data, e.g.
+// the ID of the record the ciphertext is stored in, is authenticated but not
+// encrypted, and must be passed again to DecryptWithAD.
+//
+// The ciphertext starts with a version byte followed by the KDF parameters,
+// the nonce and the sealed data.
+func EncryptWithAD(str string, secret, ad []byte) ([]byte, error) {
+	return encryptPBKDF2([]byte{versionPBKDF2}, str, secret, ad)
+}
+
+// DecryptWithAD decrypts a ciphertext produced by Encrypt or EncryptWithAD
+// with the same additional data. Legacy AES-CBC ciphertexts have no
+// additional data, it is ignored for them and they should be upgraded with
+// Migrate.
+func DecryptWithAD(ciphertext, secret, ad []byte) (string, error) {
+
+	switch version(ciphertext) {
+	case versionPBKDF2:
+		return decryptPBKDF2(ciphertext, 1, secret, ad)
+
+	case versionProvider, versionKeyring:
+		return "", fmt.Errorf("ciphertext was encrypted with a key provider or keyring")
+	}
+
+	return decryptCBC(ciphertext, secret)
+}
+
+// DecryptLegacy decrypts a ciphertext as produced by the previous versions of
+// Encrypt, using AES-CBC 256 without authentication, whatever its header.
+// The random bytes starting a few legacy ciphertexts look like the header of
+// a newer version, so Decrypt rejects them: DecryptLegacy is meant for these
+// ciphertexts when they are known to be legacy ones, e.g. from their creation
+// date. It gives no guarantee that the ciphertext has not been tampered with.
+func DecryptLegacy(ciphertext, secret []byte) (string, error) {
+	return decryptCBC(ciphertext, secret)
+}
+
+// IsLegacy reports whether the ciphertext was produced by a previous version
+// of Encrypt, using AES-CBC 256 without authentication. It only looks at the
+// header, see DecryptLegacy.
+func IsLegacy(ciphertext []byte) bool {
+	return version(ciphertext) == versionLegacy
+}
+
+// Migrate re-encrypts a legacy ciphertext with EncryptWithAD and reports
+// whether it did. Other ciphertexts are returned as is, so it can be called on
+// every ciphertext read, e.g. the tokens of a connection, and the result saved
+// when it has changed.
+func Migrate(ciphertext, secret, ad []byte) ([]byte, bool, error) {
+
+	if !IsLegacy(ciphertext) {
+		return ciphertext, false, nil
+	}
+
+	plaintext, err := decryptCBC(ciphertext, secret)
+	if err != nil {
+		return nil, false, fmt.Errorf("while decrypting legacy ciphertext: %s", err.Error())
+	}
+
+	migrated, err := EncryptWithAD(plaintext, secret, ad)
+	if err != nil {
+		return nil, false, fmt.Errorf("while encrypting: %s", err.Error())
+	}
+
+	return migrated, true, nil
+}
+
+// Returns the version of the ciphertext. Legacy ciphertexts start with random
+// bytes so the whole header is checked before assuming a version.
+func version(ciphertext []byte) byte {
+
+	if len(ciphertext) == 0 {
+		return versionLegacy
+	}
+
+	switch ciphertext[0] {
+	case versionPBKDF2:
+		if !validPBKDF2Params(ciphertext[1:]) {
+			return versionLegacy
+		}
+		return versionPBKDF2
+
+	case versionProvider:
+		if len(ciphertext) < providerHeaderSize+nonceSize+tagSize {
+			return versionLegacy
+		}
+		wrapped := int(binary.BigEndian.Uint16(ciphertext[1:3]))
+		if wrapped == 0 || len(ciphertext) < providerHeaderSize+wrapped+nonceSize+tagSize {
+			return versionLegacy
+		}
+		return versionProvider
+
+	case versionKeyring:
+		if len(ciphertext) < 2 || ciphertext[1] == 0 || len(ciphertext) < 2+int(ciphertext[1]) {
+			return versionLegacy
+		}
+		if !validPBKDF2Params(ciphertext[2+int(ciphertext[1]):]) {
+			return versionLegacy
+		}
+		return versionKeyring
+	}
+
+	return versionLegacy
+}
+
+// Encrypts the string with a key derived from the secret. The ciphertext is
+// made of the prefix, i.e. the version and key ID, followed by the KDF
+// parameters, the nonce and the sealed data.
+func encryptPBKDF2(prefix []byte, str string, secret, ad []byte) ([]byte, error) {
+
+	if DefaultIterations < minIterations || DefaultIterations > maxIterations {
+		return nil, fmt.Errorf("invalid number of PBKDF2 iterations %d", DefaultIterations)
+	}
+
+	header := make([]byte, len(prefix)+pbkdf2ParamsSize)
+	copy(header, prefix)
+
+	params := header[len(prefix):]
+	params[0] = kdfPBKDF2SHA256
+	binary.BigEndian.PutUint32(params[1:5], uint32(DefaultIterations))
+
+	// Salt and nonce
+	if _, err := io.ReadFull(rand.Reader, params[5:]); err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(secret, params[5:5+saltSize], DefaultIterations, keySize, sha256.New)
+
+	sealed, err := seal(key, params[5+saltSize:], []byte(str), additionalData(header, ad))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, sealed...), nil
+}
+
+// Decrypts a ciphertext produced by encryptPBKDF2 whose KDF parameters start
+// at the offset
+func decryptPBKDF2(ciphertext []byte, offset int, secret, ad []byte) (string, error) {
+
+	header := ciphertext[:offset+pbkdf2ParamsSize]
+	params := header[offset:]
+
+	iterations := int(binary.BigEndian.Uint32(params[1:5]))
+	key := pbkdf2.Key(secret, params[5:5+saltSize], iterations, keySize, sha256.New)
+
+	plaintext, err := open(key, params[5+saltSize:], ciphertext[len(header):], additionalData(header, ad))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// Checks the KDF parameters and the length of the data following them
+func validPBKDF2Params(data []byte) bool {
+
+	if len(data) < pbkdf2ParamsSize+tagSize || data[0] != kdfPBKDF2SHA256 {
+		return false
+	}
+
+	iterations := binary.BigEndian.Uint32(data[1:5])
+
+	return iterations >= minIterations && iterations <= maxIterations
+}
+
+// Seals the plaintext with AES-GCM, authenticating the additional data
+func seal(key, nonce, plaintext, ad []byte) ([]byte, error) {
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nil, nonce, plaintext, ad), nil
+}
+
+// Opens data sealed with the nonce and additional data
+func open(key, nonce, sealed, ad []byte) ([]byte, error) {
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Returns the authenticated header of a ciphertext followed by the additional
+// data
+func additionalData(header, ad []byte) []byte {
+
+	ret := make([]byte, 0, len(header)+len(ad))
+	ret = append(ret, header...)
+
+	return append(ret, ad...)
+}
+
+// Decrypts a ciphertext produced by the previous versions of Encrypt, using a
+// PBKDF2 key encryption method with a AES-CBC 256 algorithm
+func decryptCBC(ciphertext []byte, secret []byte) (string, error) {
+
+	if len(ciphertext) < legacyHeaderSize+aes.BlockSize {
+		return "", errors.New("ciphertext too short")
+	}
+
+	iv := ciphertext[4:legacyHeaderSize]
+
+	if (len(ciphertext)-legacyHeaderSize)%aes.BlockSize != 0 {
+		return "", errors.New("ciphertext is not a multiple of the block size")
+	}
+
+	key := pbkdf2.Key(secret, iv, 2048, keySize, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	// Decrypt into a copy to leave the caller's ciphertext untouched
+	plaintext := make([]byte, len(ciphertext)-legacyHeaderSize)
+
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(plaintext, ciphertext[legacyHeaderSize:])
+
+	unpadded, err := func(b []byte, blocksize int) ([]byte, error) {
+
+		if len(b)%blocksize != 0 {
+			return nil, errors.New("Invalid PKCS7 padding size")
+		}
+		c := b[len(b)-1]
+		n := int(c)
+		if n == 0 || n > len(b) {
+			return nil, errors.New("Invalid PKCS7 padding size")
+		}
+		for i := 0; i < n; i++ {
+			if b[len(b)-n+i] != c {
+				return nil, errors.New("Invalid PKCS7 padding size")
+			}
+		}
+		return b[:len(b)-n], nil
+	}(plaintext, aes.BlockSize)
+
+	return string(unpadded), err
+}
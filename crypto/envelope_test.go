@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/mergermarket/go-pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Produced by the AES-CBC version of Encrypt
+const legacyCiphertext = "5e3d0d73a5a8189e9474202c35e21f24133a2cfbc3c1062d5d3275bbad8f0bbda042440a606978e4f81fd4ac3a9f9ff066660419"
+
+func TestEncryptWithAD(t *testing.T) {
+
+	secret := []byte("secret")
+	ad := []byte("connection-1")
+
+	ciphertext, err := EncryptWithAD(`{"access_token":"abc"}`, secret, ad)
+	require.NoError(t, err)
+	assert.Equal(t, versionPBKDF2, ciphertext[0])
+	assert.False(t, IsLegacy(ciphertext))
+
+	plaintext, err := DecryptWithAD(ciphertext, secret, ad)
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+
+	// Ciphertexts are bound to their additional data
+	_, err = DecryptWithAD(ciphertext, secret, []byte("connection-2"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	_, err = Decrypt(ciphertext, secret)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = DecryptWithAD(ciphertext, []byte("other secret"), ad)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Tampering with the header, e.g. to lower the iterations, or the data
+	for _, i := range []int{5, 10, len(ciphertext) - 1} {
+		tampered := append([]byte{}, ciphertext...)
+		tampered[i] ^= 1
+		_, err = DecryptWithAD(tampered, secret, ad)
+		assert.ErrorIs(t, err, ErrInvalidCiphertext)
+	}
+
+	// Random salt and nonce
+	other, err := EncryptWithAD(`{"access_token":"abc"}`, secret, ad)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other)
+}
+
+func TestDecryptLegacy(t *testing.T) {
+
+	ciphertext, err := hex.DecodeString(legacyCiphertext)
+	require.NoError(t, err)
+	original := append([]byte{}, ciphertext...)
+
+	assert.True(t, IsLegacy(ciphertext))
+
+	plaintext, err := Decrypt(ciphertext, []byte("legacy secret"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+	assert.Equal(t, original, ciphertext)
+
+	for _, short := range [][]byte{nil, {1}, {1, 2, 3}, ciphertext[:20], ciphertext[:30]} {
+		_, err = Decrypt(short, []byte("legacy secret"))
+		assert.Error(t, err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+
+	secret := []byte("legacy secret")
+	ad := []byte("connection-1")
+
+	legacy, err := hex.DecodeString(legacyCiphertext)
+	require.NoError(t, err)
+
+	migrated, changed, err := Migrate(legacy, secret, ad)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, IsLegacy(migrated))
+
+	plaintext, err := DecryptWithAD(migrated, secret, ad)
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+
+	again, changed, err := Migrate(migrated, secret, ad)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, migrated, again)
+
+	_, _, err = Migrate(legacy, []byte("other secret"), ad)
+	assert.Error(t, err)
+}
+
+// Encrypts the string as the AES-CBC version of Encrypt did, with a header
+// starting with the prefix instead of random bytes
+func encryptLegacy(t *testing.T, str string, secret, prefix []byte) []byte {
+
+	header := make([]byte, legacyHeaderSize)
+	_, err := rand.Read(header)
+	require.NoError(t, err)
+	copy(header, prefix)
+
+	iv := header[4:]
+	padded, err := pkcs7.Pad([]byte(str), aes.BlockSize)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(pbkdf2.Key(secret, iv, 2048, keySize, sha256.New))
+	require.NoError(t, err)
+
+	ciphertext := append(header, make([]byte, len(padded))...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext[legacyHeaderSize:], padded)
+
+	return ciphertext
+}
+
+func TestDecryptLegacyLookingLikeHeader(t *testing.T) {
+
+	secret := []byte("legacy secret")
+
+	tests := []struct {
+		name    string
+		prefix  []byte
+		version byte
+	}{
+		{name: "Version 1", prefix: []byte{versionPBKDF2, kdfPBKDF2SHA256, 0, 1, 0x86, 0xa0}, version: versionPBKDF2},
+		{name: "Version 2", prefix: []byte{versionProvider, 0, 1}, version: versionProvider},
+		{name: "Version 3", prefix: []byte{versionKeyring, 1, 'a', kdfPBKDF2SHA256, 0, 1, 0x86, 0xa0}, version: versionKeyring},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext := encryptLegacy(t, `{"access_token":"abc"}`, secret, tt.prefix)
+			require.Equal(t, tt.version, version(ciphertext))
+
+			_, err := Decrypt(ciphertext, secret)
+			assert.Error(t, err)
+
+			migrated, changed, err := Migrate(ciphertext, secret, nil)
+			require.NoError(t, err)
+			assert.False(t, changed)
+			assert.Equal(t, ciphertext, migrated)
+
+			plaintext, err := DecryptLegacy(ciphertext, secret)
+			require.NoError(t, err)
+			assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package crypto
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Keyring holds the secrets used to encrypt and decrypt data, identified by a
+// key ID stored in each ciphertext. New data is encrypted with the active
+// secret while the others can still decrypt the data they encrypted, so a
+// secret can be rotated without re-encrypting everything at once.
+type Keyring struct {
+	// ID of the secret the ciphertexts without key ID, produced by Encrypt
+	// and EncryptWithAD, were encrypted with. They cannot be decrypted if not
+	// set.
+	LegacyKeyID string
+
+	mu      sync.RWMutex
+	secrets map[string][]byte
+	active  string
+}
+
+// NewKeyring creates a keyring holding the secrets by key ID and encrypting
+// with the active one.
+func NewKeyring(active string, secrets map[string][]byte) (*Keyring, error) {
+
+	k := &Keyring{}
+
+	for id, secret := range secrets {
+		if err := k.Add(id, secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.SetActive(active); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Add adds a secret to the keyring, replacing the one with the same ID.
+func (k *Keyring) Add(id string, secret []byte) error {
+
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("invalid key ID '%s'", id)
+	}
+	if len(secret) == 0 {
+		return fmt.Errorf("empty secret for key '%s'", id)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.secrets == nil {
+		k.secrets = make(map[string][]byte)
+	}
+	k.secrets[id] = append([]byte{}, secret...)
+
+	return nil
+}
+
+// Remove removes a secret from the keyring, once no data is encrypted with it
+// anymore. The active secret cannot be removed.
+func (k *Keyring) Remove(id string) error {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if id == k.active {
+		return fmt.Errorf("key '%s' is active", id)
+	}
+
+	delete(k.secrets, id)
+
+	return nil
+}
+
+// SetActive sets the secret new data is encrypted with.
+func (k *Keyring) SetActive(id string) error {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.secrets[id]; !ok {
+		return fmt.Errorf("unknown key '%s'", id)
+	}
+
+	k.active = id
+
+	return nil
+}
+
+// Active returns the ID of the active secret.
+func (k *Keyring) Active() string {
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// Encrypt encrypts the string with the active secret as EncryptWithAD does,
+// and stores its key ID in the ciphertext.
+func (k *Keyring) Encrypt(str string, ad []byte) ([]byte, error) {
+
+	id, secret := k.activeSecret()
+	if id == "" {
+		return nil, fmt.Errorf("no active key")
+	}
+
+	prefix := append([]byte{versionKeyring, byte(len(id))}, id...)
+
+	return encryptPBKDF2(prefix, str, secret, ad)
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with the secret of its key
+// ID. Ciphertexts without key ID are decrypted with the LegacyKeyID secret.
+func (k *Keyring) Decrypt(ciphertext, ad []byte) (string, error) {
+
+	plaintext, _, err := k.decrypt(ciphertext, ad)
+
+	return plaintext, err
+}
+
+// DecryptAndReencrypt decrypts a ciphertext and, unless it is already
+// encrypted with the active secret, re-encrypts it with it. It is meant to
+// upgrade ciphertexts lazily when they are read: the returned ciphertext is
+// nil when there is no need to save it again.
+func (k *Keyring) DecryptAndReencrypt(ciphertext, ad []byte) (string, []byte, error) {
+
+	plaintext, id, err := k.decrypt(ciphertext, ad)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if id != "" && id == k.Active() {
+		return plaintext, nil, nil
+	}
+
+	reencrypted, err := k.Encrypt(plaintext, ad)
+	if err != nil {
+		return "", nil, fmt.Errorf("while re-encrypting: %s", err.Error())
+	}
+
+	return plaintext, reencrypted, nil
+}
+
+// Decrypts the ciphertext and returns the key ID it was encrypted with, empty
+// for the ciphertexts without key ID
+func (k *Keyring) decrypt(ciphertext, ad []byte) (string, string, error) {
+
+	if version(ciphertext) == versionKeyring {
+		id := string(ciphertext[2 : 2+int(ciphertext[1])])
+
+		secret, err := k.secret(id)
+		if err != nil {
+			return "", "", err
+		}
+
+		plaintext, err := decryptPBKDF2(ciphertext, 2+len(id), secret, ad)
+		if err != nil {
+			return "", "", err
+		}
+
+		return plaintext, id, nil
+	}
+
+	secret, err := k.legacySecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	plaintext, err := DecryptWithAD(ciphertext, secret, ad)
+
+	return plaintext, "", err
+}
+
+func (k *Keyring) legacySecret() ([]byte, error) {
+
+	if k.LegacyKeyID == "" {
+		return nil, fmt.Errorf("ciphertext has no key ID and no legacy key is set")
+	}
+
+	return k.secret(k.LegacyKeyID)
+}
+
+func (k *Keyring) secret(id string) ([]byte, error) {
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	secret, ok := k.secrets[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key '%s'", id)
+	}
+
+	return secret, nil
+}
+
+func (k *Keyring) activeSecret() (string, []byte) {
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active, k.secrets[k.active]
+}
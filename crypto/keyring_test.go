@@ -0,0 +1,143 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+
+	ad := []byte("connection-1")
+
+	keyring, err := NewKeyring("2022", map[string][]byte{"2022": []byte("old secret")})
+	require.NoError(t, err)
+
+	old, err := keyring.Encrypt("abc", ad)
+	require.NoError(t, err)
+	assert.Equal(t, versionKeyring, old[0])
+
+	// Rotation
+	require.NoError(t, keyring.Add("2023", []byte("new secret")))
+	require.NoError(t, keyring.SetActive("2023"))
+	assert.Equal(t, "2023", keyring.Active())
+
+	current, err := keyring.Encrypt("abc", ad)
+	require.NoError(t, err)
+
+	for _, ciphertext := range [][]byte{old, current} {
+		plaintext, err := keyring.Decrypt(ciphertext, ad)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", plaintext)
+	}
+
+	_, err = keyring.Decrypt(current, []byte("connection-2"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Changing the key ID does not change the secret used
+	tampered := append([]byte{}, old...)
+	copy(tampered[2:6], "2023")
+	_, err = keyring.Decrypt(tampered, ad)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Lazy upgrade
+	plaintext, upgraded, err := keyring.DecryptAndReencrypt(old, ad)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", plaintext)
+	require.NotNil(t, upgraded)
+	assert.Equal(t, "2023", string(upgraded[2:6]))
+
+	plaintext, upgraded, err = keyring.DecryptAndReencrypt(current, ad)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", plaintext)
+	assert.Nil(t, upgraded)
+
+	assert.Error(t, keyring.Remove("2023"))
+	require.NoError(t, keyring.Remove("2022"))
+	_, err = keyring.Decrypt(old, ad)
+	assert.Error(t, err)
+
+	_, err = NewKeyring("missing", map[string][]byte{"2022": []byte("old secret")})
+	assert.Error(t, err)
+}
+
+func TestKeyringLegacy(t *testing.T) {
+
+	keyring, err := NewKeyring("2023", map[string][]byte{
+		"legacy": []byte("legacy secret"),
+		"2023":   []byte("new secret"),
+	})
+	require.NoError(t, err)
+
+	legacy, err := hex.DecodeString(legacyCiphertext)
+	require.NoError(t, err)
+	passphrase, err := EncryptWithAD(`{"access_token":"abc"}`, []byte("legacy secret"), nil)
+	require.NoError(t, err)
+
+	_, err = keyring.Decrypt(legacy, nil)
+	assert.Error(t, err)
+
+	keyring.LegacyKeyID = "legacy"
+
+	for _, ciphertext := range [][]byte{legacy, passphrase} {
+		plaintext, upgraded, err := keyring.DecryptAndReencrypt(ciphertext, nil)
+		require.NoError(t, err)
+		assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+		require.NotNil(t, upgraded)
+
+		plaintext, err = keyring.Decrypt(upgraded, nil)
+		require.NoError(t, err)
+		assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+	}
+}
+
+func TestKeyringZeroValue(t *testing.T) {
+
+	var keyring Keyring
+
+	_, err := keyring.Encrypt("abc", nil)
+	assert.Error(t, err)
+
+	require.NoError(t, keyring.Add("2023", []byte("secret")))
+	_, err = keyring.Encrypt("abc", nil)
+	assert.Error(t, err, "no active key")
+
+	require.NoError(t, keyring.SetActive("2023"))
+	ciphertext, err := keyring.Encrypt("abc", nil)
+	require.NoError(t, err)
+
+	plaintext, err := keyring.Decrypt(ciphertext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", plaintext)
+}
+
+func TestKeyringAuthenticationFailure(t *testing.T) {
+
+	keyring, err := NewKeyring("2023", map[string][]byte{
+		"legacy": []byte("legacy secret"),
+		"2023":   []byte("new secret"),
+	})
+	require.NoError(t, err)
+	keyring.LegacyKeyID = "legacy"
+
+	ciphertext, err := keyring.Encrypt(`{"access_token":"abc"}`, nil)
+	require.NoError(t, err)
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+
+	for name, ciphertext := range map[string][]byte{
+		"Tampered":    tampered,
+		"Unknown key": encryptLegacy(t, `{"access_token":"abc"}`, []byte("legacy secret"), []byte{versionKeyring, 1, 'a', kdfPBKDF2SHA256, 0, 1, 0x86, 0xa0}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, versionKeyring, version(ciphertext))
+
+			// Never retried as a legacy ciphertext, nor re-encrypted
+			_, upgraded, err := keyring.DecryptAndReencrypt(ciphertext, nil)
+			assert.Error(t, err)
+			assert.Nil(t, upgraded)
+		})
+	}
+}
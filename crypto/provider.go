@@ -0,0 +1,208 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// version and length of the wrapped data key
+const providerHeaderSize = 1 + 2
+
+// KeyProvider wraps and unwraps data keys with a key encryption key it holds,
+// e.g. in memory, in a file or in a HSM. The http/v2 KeyVault implements it
+// with Azure Key Vault.
+type KeyProvider interface {
+	// WrapKey encrypts a data key
+	WrapKey(key []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped by WrapKey
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// MemoryKeyProvider is a KeyProvider wrapping data keys with AES-GCM 256 and a
+// key encryption key held in memory.
+type MemoryKeyProvider struct {
+	kek []byte
+}
+
+// NewMemoryKeyProvider creates a provider using the 32 bytes key encryption
+// key.
+func NewMemoryKeyProvider(kek []byte) (*MemoryKeyProvider, error) {
+
+	if len(kek) != keySize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes long, got %d", keySize, len(kek))
+	}
+
+	return &MemoryKeyProvider{kek: append([]byte{}, kek...)}, nil
+}
+
+// WrapKey implements the KeyProvider interface.
+func (p *MemoryKeyProvider) WrapKey(key []byte) ([]byte, error) {
+
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(p.kek, nonce, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(nonce, sealed...), nil
+}
+
+// UnwrapKey implements the KeyProvider interface.
+func (p *MemoryKeyProvider) UnwrapKey(wrapped []byte) ([]byte, error) {
+
+	if len(wrapped) < nonceSize+tagSize {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return open(p.kek, wrapped[:nonceSize], wrapped[nonceSize:], nil)
+}
+
+// FileKeyProvider is a MemoryKeyProvider whose key encryption key is read from
+// a file.
+type FileKeyProvider struct {
+	*MemoryKeyProvider
+	Path string
+}
+
+// NewFileKeyProvider creates a provider reading the key encryption key from
+// the file, either as 32 raw bytes or base64 encoded.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading key file '%s': %s", path, err.Error())
+	}
+
+	kek := data
+	if len(data) != keySize {
+		kek, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("while decoding key file '%s': %s", path, err.Error())
+		}
+	}
+
+	p, err := NewMemoryKeyProvider(kek)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file '%s': %s", path, err.Error())
+	}
+
+	return &FileKeyProvider{MemoryKeyProvider: p, Path: path}, nil
+}
+
+// EncryptWithProvider encrypts the string with AES-GCM 256 and a random data
+// key wrapped by the provider. The wrapped key is stored in the ciphertext, so
+// the key encryption key can be rotated with RewrapKey without re-encrypting
+// the data. The additional data is authenticated as with EncryptWithAD.
+func EncryptWithProvider(str string, provider KeyProvider, ad []byte) ([]byte, error) {
+
+	key := make([]byte, keySize)
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := provider.WrapKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("while wrapping data key: %s", err.Error())
+	}
+
+	sealed, err := seal(key, nonce, []byte(str), providerAdditionalData(nonce, ad))
+	if err != nil {
+		return nil, err
+	}
+
+	return providerCiphertext(wrapped, nonce, sealed)
+}
+
+// DecryptWithProvider decrypts a ciphertext produced by EncryptWithProvider
+// with the same additional data.
+func DecryptWithProvider(ciphertext []byte, provider KeyProvider, ad []byte) (string, error) {
+
+	wrapped, nonce, sealed, err := parseProviderCiphertext(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := provider.UnwrapKey(wrapped)
+	if err != nil {
+		return "", fmt.Errorf("while unwrapping data key: %s", err.Error())
+	}
+
+	plaintext, err := open(key, nonce, sealed, providerAdditionalData(nonce, ad))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// RewrapKey unwraps the data key of a ciphertext produced by
+// EncryptWithProvider with one provider and wraps it with another, e.g. when
+// rotating the key encryption key. The encrypted data is left as is.
+func RewrapKey(ciphertext []byte, from, to KeyProvider) ([]byte, error) {
+
+	wrapped, nonce, sealed, err := parseProviderCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := from.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("while unwrapping data key: %s", err.Error())
+	}
+
+	rewrapped, err := to.WrapKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("while wrapping data key: %s", err.Error())
+	}
+
+	return providerCiphertext(rewrapped, nonce, sealed)
+}
+
+// Returns a version 2 ciphertext made of the version, the length of the
+// wrapped key, the wrapped key, the nonce and the sealed data
+func providerCiphertext(wrapped, nonce, sealed []byte) ([]byte, error) {
+
+	if len(wrapped) == 0 || len(wrapped) > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid wrapped data key length %d", len(wrapped))
+	}
+
+	ret := make([]byte, providerHeaderSize, providerHeaderSize+len(wrapped)+len(nonce)+len(sealed))
+	ret[0] = versionProvider
+	binary.BigEndian.PutUint16(ret[1:3], uint16(len(wrapped)))
+
+	ret = append(ret, wrapped...)
+	ret = append(ret, nonce...)
+
+	return append(ret, sealed...), nil
+}
+
+func parseProviderCiphertext(ciphertext []byte) (wrapped, nonce, sealed []byte, err error) {
+
+	if version(ciphertext) != versionProvider {
+		return nil, nil, nil, fmt.Errorf("ciphertext was not encrypted with a key provider")
+	}
+
+	end := providerHeaderSize + int(binary.BigEndian.Uint16(ciphertext[1:3]))
+
+	return ciphertext[providerHeaderSize:end], ciphertext[end : end+nonceSize], ciphertext[end+nonceSize:], nil
+}
+
+// The wrapped key is not authenticated so it can be replaced by RewrapKey,
+// tampering with it leads to another data key which fails to open the data
+func providerAdditionalData(nonce, ad []byte) []byte {
+	return additionalData(append([]byte{versionProvider}, nonce...), ad)
+}
@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptWithProvider(t *testing.T) {
+
+	provider, err := NewMemoryKeyProvider(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	ad := []byte("connection-1")
+
+	ciphertext, err := EncryptWithProvider(`{"access_token":"abc"}`, provider, ad)
+	require.NoError(t, err)
+	assert.Equal(t, versionProvider, ciphertext[0])
+	assert.False(t, IsLegacy(ciphertext))
+
+	plaintext, err := DecryptWithProvider(ciphertext, provider, ad)
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+
+	_, err = DecryptWithProvider(ciphertext, provider, []byte("connection-2"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	other, err := NewMemoryKeyProvider(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = DecryptWithProvider(ciphertext, other, ad)
+	assert.Error(t, err)
+
+	_, err = Decrypt(ciphertext, []byte("secret"))
+	assert.Error(t, err)
+
+	passphrase, err := Encrypt("abc", []byte("secret"))
+	require.NoError(t, err)
+	_, err = DecryptWithProvider(passphrase, provider, nil)
+	assert.Error(t, err)
+
+	// Rotating the key encryption key
+	rewrapped, err := RewrapKey(ciphertext, provider, other)
+	require.NoError(t, err)
+	assert.Equal(t, ciphertext[len(ciphertext)-40:], rewrapped[len(rewrapped)-40:])
+
+	plaintext, err = DecryptWithProvider(rewrapped, other, ad)
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"abc"}`, plaintext)
+
+	_, err = DecryptWithProvider(rewrapped, provider, ad)
+	assert.Error(t, err)
+
+	_, err = RewrapKey(ciphertext, other, provider)
+	assert.Error(t, err)
+
+	_, err = NewMemoryKeyProvider([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestFileKeyProvider(t *testing.T) {
+
+	dir := t.TempDir()
+	kek := bytes.Repeat([]byte{3}, 32)
+
+	raw := filepath.Join(dir, "raw.key")
+	require.NoError(t, ioutil.WriteFile(raw, kek, 0600))
+	encoded := filepath.Join(dir, "encoded.key")
+	require.NoError(t, ioutil.WriteFile(encoded, []byte(base64.StdEncoding.EncodeToString(kek)+"\n"), 0600))
+	invalid := filepath.Join(dir, "invalid.key")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte("not a key"), 0600))
+
+	rawProvider, err := NewFileKeyProvider(raw)
+	require.NoError(t, err)
+	encodedProvider, err := NewFileKeyProvider(encoded)
+	require.NoError(t, err)
+
+	ciphertext, err := EncryptWithProvider("abc", rawProvider, nil)
+	require.NoError(t, err)
+	plaintext, err := DecryptWithProvider(ciphertext, encodedProvider, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", plaintext)
+
+	_, err = NewFileKeyProvider(invalid)
+	assert.Error(t, err)
+	_, err = NewFileKeyProvider(filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,272 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default tolerance of the webhook timestamps
+const defaultWebhookTolerance = 5 * time.Minute
+
+// Errors returned by the webhook verifiers
+var (
+	ErrMissingSignature = errors.New("missing webhook signature")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleWebhook     = errors.New("webhook timestamp is outside of the tolerance")
+	ErrMissingSecret    = errors.New("webhook verifier has no secret")
+)
+
+// WebhookVerifier verifies the signature of a webhook delivery.
+type WebhookVerifier interface {
+	// Verify returns an error if the headers have no valid signature of the
+	// body, or if the delivery is stale
+	Verify(header http.Header, body []byte) error
+}
+
+// SignatureEncoding is the encoding of an HMAC signature in a header.
+type SignatureEncoding int
+
+// Signature encodings
+const (
+	SignatureBase64 SignatureEncoding = iota
+	SignatureHex
+)
+
+// ConstantTimeEqual compares two signatures in constant time.
+func ConstantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// HMACSHA256Verifier verifies webhooks whose header holds the HMAC-SHA256 of
+// the body, e.g. Xero (x-xero-signature) and QuickBooks (intuit-signature)
+// with the base64 encoding.
+type HMACSHA256Verifier struct {
+	Secret []byte
+	// Header holding the signature
+	Header   string
+	Encoding SignatureEncoding
+	// Optional prefix of the signature, e.g. "sha256="
+	Prefix string
+	// Optional header holding the UNIX timestamp of the delivery. When set,
+	// the timestamp followed by a dot and the body is signed.
+	TimestampHeader string
+	// Tolerance of the timestamp, 5 minutes if not set
+	Tolerance time.Duration
+}
+
+// Sign returns the headers signing the body delivered at the timestamp.
+func (v HMACSHA256Verifier) Sign(body []byte, timestamp time.Time) http.Header {
+
+	header := http.Header{}
+
+	ts := ""
+	if v.TimestampHeader != "" {
+		ts = strconv.FormatInt(timestamp.Unix(), 10)
+		header.Set(v.TimestampHeader, ts)
+	}
+
+	header.Set(v.Header, v.Prefix+v.encode(v.mac(ts, body)))
+
+	return header
+}
+
+// Verify implements the WebhookVerifier interface.
+func (v HMACSHA256Verifier) Verify(header http.Header, body []byte) error {
+
+	// Anyone can sign with an empty key
+	if len(v.Secret) == 0 {
+		return ErrMissingSecret
+	}
+
+	signature := header.Get(v.Header)
+	if signature == "" {
+		return ErrMissingSignature
+	}
+
+	ts := ""
+	if v.TimestampHeader != "" {
+		ts = header.Get(v.TimestampHeader)
+		if err := checkWebhookTimestamp(ts, v.Tolerance); err != nil {
+			return err
+		}
+	}
+
+	if !strings.HasPrefix(signature, v.Prefix) {
+		return ErrInvalidSignature
+	}
+
+	if !ConstantTimeEqual(strings.TrimPrefix(signature, v.Prefix), v.encode(v.mac(ts, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (v HMACSHA256Verifier) mac(timestamp string, body []byte) []byte {
+
+	hash := hmac.New(sha256.New, v.Secret)
+	if v.TimestampHeader != "" {
+		hash.Write([]byte(timestamp + "."))
+	}
+	hash.Write(body)
+
+	return hash.Sum(nil)
+}
+
+func (v HMACSHA256Verifier) encode(mac []byte) string {
+
+	if v.Encoding == SignatureHex {
+		return hex.EncodeToString(mac)
+	}
+
+	return base64.StdEncoding.EncodeToString(mac)
+}
+
+// StripeVerifier verifies the Stripe-Signature header of Stripe webhooks, made
+// of a timestamp and one or more HMAC-SHA256 signatures: t=...,v1=...,v1=...
+type StripeVerifier struct {
+	// Signing secret of the endpoint, whsec_...
+	Secret string
+	// Tolerance of the timestamp, 5 minutes if not set
+	Tolerance time.Duration
+}
+
+// Sign returns the headers signing the body delivered at the timestamp.
+func (v StripeVerifier) Sign(body []byte, timestamp time.Time) http.Header {
+
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s", ts, v.mac(ts, body)))
+
+	return header
+}
+
+// Verify implements the WebhookVerifier interface.
+func (v StripeVerifier) Verify(header http.Header, body []byte) error {
+
+	// Anyone can sign with an empty key
+	if v.Secret == "" {
+		return ErrMissingSecret
+	}
+
+	value := header.Get("Stripe-Signature")
+	if value == "" {
+		return ErrMissingSignature
+	}
+
+	var ts string
+	var signatures []string
+
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "t":
+			ts = parts[1]
+		case "v1":
+			signatures = append(signatures, parts[1])
+		}
+	}
+
+	if ts == "" || len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+
+	if err := checkWebhookTimestamp(ts, v.Tolerance); err != nil {
+		return err
+	}
+
+	// Several signatures are sent while the secret is being rolled
+	expected := v.mac(ts, body)
+	for _, signature := range signatures {
+		if ConstantTimeEqual(signature, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func (v StripeVerifier) mac(timestamp string, body []byte) string {
+
+	hash := hmac.New(sha256.New, []byte(v.Secret))
+	hash.Write([]byte(timestamp + "."))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Checks that the UNIX timestamp is within the tolerance of the current time
+func checkWebhookTimestamp(timestamp string, tolerance time.Duration) error {
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleWebhook
+	}
+
+	if tolerance == 0 {
+		tolerance = defaultWebhookTolerance
+	}
+
+	delta := time.Since(time.Unix(seconds, 0))
+	if delta > tolerance || delta < -tolerance {
+		return ErrStaleWebhook
+	}
+
+	return nil
+}
+
+// WebhookRegistry holds the webhook verifiers by provider, e.g. stripe, xero
+// or quickbooks.
+type WebhookRegistry struct {
+	mu        sync.RWMutex
+	verifiers map[string]WebhookVerifier
+}
+
+// NewWebhookRegistry creates an empty registry.
+func NewWebhookRegistry() *WebhookRegistry {
+	return &WebhookRegistry{verifiers: make(map[string]WebhookVerifier)}
+}
+
+// Register sets the verifier of the provider.
+func (r *WebhookRegistry) Register(provider string, verifier WebhookVerifier) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.verifiers[provider] = verifier
+}
+
+// Get returns the verifier of the provider.
+func (r *WebhookRegistry) Get(provider string) (WebhookVerifier, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	verifier, ok := r.verifiers[provider]
+	return verifier, ok
+}
+
+// Verify verifies a delivery with the verifier of the provider.
+func (r *WebhookRegistry) Verify(provider string, header http.Header, body []byte) error {
+
+	verifier, ok := r.Get(provider)
+	if !ok {
+		return fmt.Errorf("no webhook verifier for provider '%s'", provider)
+	}
+
+	return verifier.Verify(header, body)
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookVerifiers(t *testing.T) {
+
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Now()
+
+	stripe := StripeVerifier{Secret: "whsec_test"}
+	xero := HMACSHA256Verifier{Secret: []byte("xero"), Header: "X-Xero-Signature"}
+	github := HMACSHA256Verifier{Secret: []byte("github"), Header: "X-Hub-Signature-256", Encoding: SignatureHex, Prefix: "sha256="}
+	timestamped := HMACSHA256Verifier{Secret: []byte("secret"), Header: "X-Signature", Encoding: SignatureHex, TimestampHeader: "X-Timestamp", Tolerance: time.Minute}
+
+	// Stripe sends a signature per secret while it is being rolled
+	parts := strings.SplitN(stripe.Sign(body, now).Get("Stripe-Signature"), ",", 2)
+	rolled := http.Header{"Stripe-Signature": []string{parts[0] + ",v1=deadbeef," + parts[1] + ",v0=deadbeef"}}
+
+	tests := []struct {
+		name     string
+		verifier WebhookVerifier
+		header   http.Header
+		body     []byte
+		err      error
+	}{
+		{name: "Stripe", verifier: stripe, header: stripe.Sign(body, now), body: body},
+		{name: "Stripe several signatures", verifier: stripe, header: rolled, body: body},
+		{name: "Stripe other secret", verifier: stripe, header: StripeVerifier{Secret: "whsec_other"}.Sign(body, now), body: body, err: ErrInvalidSignature},
+		{name: "Stripe modified body", verifier: stripe, header: stripe.Sign(body, now), body: []byte(`{"id":"evt_2"}`), err: ErrInvalidSignature},
+		{name: "Stripe stale", verifier: stripe, header: stripe.Sign(body, now.Add(-time.Hour)), body: body, err: ErrStaleWebhook},
+		{name: "Stripe missing signature", verifier: stripe, header: http.Header{"Stripe-Signature": []string{"t=123"}}, body: body, err: ErrMissingSignature},
+		{name: "Base64", verifier: xero, header: xero.Sign(body, now), body: body},
+		{name: "Base64 invalid", verifier: xero, header: http.Header{"X-Xero-Signature": []string{"abc="}}, body: body, err: ErrInvalidSignature},
+		{name: "Base64 missing", verifier: xero, header: http.Header{}, body: body, err: ErrMissingSignature},
+		{name: "Hex with prefix", verifier: github, header: github.Sign(body, now), body: body},
+		{name: "Hex without prefix", verifier: github, header: http.Header{"X-Hub-Signature-256": []string{github.Sign(body, now).Get("X-Hub-Signature-256")[len("sha256="):]}}, body: body, err: ErrInvalidSignature},
+		{name: "Stripe empty secret", verifier: StripeVerifier{}, header: StripeVerifier{}.Sign(body, now), body: body, err: ErrMissingSecret},
+		{name: "HMAC empty secret", verifier: HMACSHA256Verifier{Header: "X-Signature"}, header: HMACSHA256Verifier{Header: "X-Signature"}.Sign(body, now), body: body, err: ErrMissingSecret},
+		{name: "Timestamp", verifier: timestamped, header: timestamped.Sign(body, now), body: body},
+		{name: "Timestamp stale", verifier: timestamped, header: timestamped.Sign(body, now.Add(-2*time.Minute)), body: body, err: ErrStaleWebhook},
+		{name: "Timestamp in the future", verifier: timestamped, header: timestamped.Sign(body, now.Add(2*time.Minute)), body: body, err: ErrStaleWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.verifier.Verify(tt.header, tt.body)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhookRegistry(t *testing.T) {
+
+	registry := NewWebhookRegistry()
+	registry.Register("stripe", StripeVerifier{Secret: "whsec_test"})
+
+	body := []byte(`{"id":"evt_1"}`)
+	header := StripeVerifier{Secret: "whsec_test"}.Sign(body, time.Now())
+
+	assert.NoError(t, registry.Verify("stripe", header, body))
+	assert.Error(t, registry.Verify("xero", header, body))
+
+	_, ok := registry.Get("stripe")
+	assert.True(t, ok)
+}
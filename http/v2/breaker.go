@@ -0,0 +1,306 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// Requests flow normally and failures are being counted.
+	BreakerClosed BreakerState = iota
+	// Requests are rejected without reaching the destination host.
+	BreakerOpen
+	// A limited number of probe requests are let through to find out whether
+	// the destination host has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown (%d)", int(s))
+}
+
+// ErrCircuitOpen is the sentinel error wrapped by all CircuitOpenError values.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned when a request is short-circuited because the
+// circuit breaker for its destination host is open.
+type CircuitOpenError struct {
+	Host string
+	// The time at which the breaker will let probe requests through again.
+	// Zero if the breaker is half-open, as it is only known once the probes
+	// in flight complete.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAt.IsZero() {
+		return fmt.Sprintf("%s: %s (probing)", ErrCircuitOpen.Error(), e.Host)
+	}
+	return fmt.Sprintf("%s: %s (retry at %s)", ErrCircuitOpen.Error(), e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// BreakerOptions controls when the circuit breakers managed by a
+// BreakerRegistry open and close. Zero values are replaced with the values in
+// DefaultBreakerOptions.
+type BreakerOptions struct {
+	// Ratio of failed requests, between 0 and 1, which opens the breaker.
+	FailureThreshold float64
+	// Minimum number of requests in a window before the failure ratio is
+	// taken into account.
+	MinRequests int
+	// Length of the window over which failures are counted.
+	Window time.Duration
+	// How long the breaker stays open before letting probe requests through.
+	OpenTimeout time.Duration
+	// Number of consecutive successful probes required to close the breaker.
+	HalfOpenRequests int
+	// Optional predicate deciding whether an outcome counts as a failure.
+	// When not set, the same outcomes retried by the Retry middleware are
+	// considered failures.
+	IsFailure func(*Response, error) bool
+}
+
+// DefaultBreakerOptions are the options used for any BreakerOptions attribute
+// which has not been set.
+var DefaultBreakerOptions = BreakerOptions{
+	FailureThreshold: 0.5,
+	MinRequests:      10,
+	Window:           time.Minute,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+// BreakerRegistry holds one circuit breaker per destination host. A registry
+// is safe for concurrent use and is meant to be shared by all the Request
+// values calling the same set of hosts, so that they all learn about an
+// unhealthy host at the same time.
+type BreakerRegistry struct {
+	opts     BreakerOptions
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	now      func() time.Time
+}
+
+// Tracks the outcome of the requests sent to a single host.
+type breaker struct {
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// NewBreakerRegistry creates a new, empty, registry.
+func NewBreakerRegistry(opts BreakerOptions) *BreakerRegistry {
+	return &BreakerRegistry{
+		opts:     opts.withDefaults(),
+		breakers: make(map[string]*breaker),
+		now:      time.Now,
+	}
+}
+
+func (opts BreakerOptions) withDefaults() BreakerOptions {
+	if opts.FailureThreshold <= 0 || opts.FailureThreshold > 1 {
+		opts.FailureThreshold = DefaultBreakerOptions.FailureThreshold
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultBreakerOptions.MinRequests
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultBreakerOptions.Window
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = DefaultBreakerOptions.OpenTimeout
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = DefaultBreakerOptions.HalfOpenRequests
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsRetryable
+	}
+	return opts
+}
+
+// CircuitBreaker returns a middleware that short-circuits requests to hosts
+// whose breaker is open, returning a *CircuitOpenError instead.
+//
+// When combined with the Retry middleware, adding the breaker after Retry
+// counts every attempt individually and stops retrying as soon as the breaker
+// opens.
+func CircuitBreaker(registry *BreakerRegistry) MiddlewareFunc {
+	return func(next Middleware) Middleware {
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			host, err := breakerHost(request.URL)
+			if err != nil {
+				return next(ctx, request)
+			}
+
+			if err := registry.allow(host); err != nil {
+				return nil, err
+			}
+
+			response, err := next(ctx, request)
+
+			// Requests interrupted by the caller say nothing about the host
+			if err != nil && ctx.Err() != nil {
+				registry.cancel(host)
+				return response, err
+			}
+
+			registry.record(host, registry.opts.IsFailure(response, err))
+
+			return response, err
+		}
+	}
+}
+
+// State returns the current state of the breaker for the specified host.
+func (r *BreakerRegistry) State(host string) BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[host]
+	if !ok {
+		return BreakerClosed
+	}
+
+	if b.state == BreakerOpen && !r.now().Before(b.openedAt.Add(r.opts.OpenTimeout)) {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+// Reset closes the breaker for the specified host and forgets its history.
+func (r *BreakerRegistry) Reset(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.breakers, host)
+}
+
+// Checks whether a request to the specified host may go ahead.
+func (r *BreakerRegistry) allow(host string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+
+	b, ok := r.breakers[host]
+	if !ok {
+		b = &breaker{state: BreakerClosed, windowStart: now}
+		r.breakers[host] = b
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		retryAt := b.openedAt.Add(r.opts.OpenTimeout)
+		if now.Before(retryAt) {
+			return &CircuitOpenError{Host: host, RetryAt: retryAt}
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.successes = 0
+		fallthrough
+
+	case BreakerHalfOpen:
+		if b.probes >= r.opts.HalfOpenRequests {
+			return &CircuitOpenError{Host: host}
+		}
+		b.probes++
+
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= r.opts.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+	}
+
+	return nil
+}
+
+// Records the outcome of a request to the specified host.
+func (r *BreakerRegistry) record(host string, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[host]
+	if !ok {
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= r.opts.MinRequests && float64(b.failures)/float64(b.requests) >= r.opts.FailureThreshold {
+			b.trip(r.now())
+		}
+
+	case BreakerHalfOpen:
+		if failed {
+			b.trip(r.now())
+			return
+		}
+		b.successes++
+		if b.successes >= r.opts.HalfOpenRequests {
+			*b = breaker{state: BreakerClosed, windowStart: r.now()}
+		}
+	}
+}
+
+// Releases the probe slot taken by a request that was cancelled by the caller.
+func (r *BreakerRegistry) cancel(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[host]; ok && b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Opens the breaker.
+func (b *breaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+}
+
+// Extracts the host, including the port if any, from the request URL.
+func breakerHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("no host in URL '%s'", rawURL)
+	}
+	return u.Host, nil
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	status := http.StatusServiceUnavailable
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	host := u.Host
+
+	now := time.Now()
+	registry := NewBreakerRegistry(BreakerOptions{
+		FailureThreshold: 0.5,
+		MinRequests:      2,
+		OpenTimeout:      time.Minute,
+	})
+	registry.now = func() time.Time { return now }
+
+	send := func() (*Response, error) {
+		request := Request{URL: ts.URL}
+		request.Use(CircuitBreaker(registry))
+		return request.Get(context.Background())
+	}
+
+	// Two failures open the breaker
+	for i := 0; i < 2; i++ {
+		_, err := send()
+		require.NoError(err)
+	}
+	assert.Equal(BreakerOpen, registry.State(host))
+
+	// Requests are short-circuited while open
+	_, err := send()
+	require.Error(err)
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	var openErr *CircuitOpenError
+	require.True(errors.As(err, &openErr))
+	assert.Equal(host, openErr.Host)
+	assert.Equal(now.Add(time.Minute), openErr.RetryAt)
+	assert.Equal(2, calls)
+
+	// A failed probe opens the breaker again
+	now = now.Add(time.Minute)
+	assert.Equal(BreakerHalfOpen, registry.State(host))
+	_, err = send()
+	require.NoError(err)
+	assert.Equal(3, calls)
+	assert.Equal(BreakerOpen, registry.State(host))
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+	_, err = send()
+	require.NoError(err)
+	assert.Equal(4, calls)
+	assert.Equal(BreakerClosed, registry.State(host))
+}
+
+func TestCircuitBreakerIsolatesHosts(t *testing.T) {
+	registry := NewBreakerRegistry(BreakerOptions{MinRequests: 1})
+
+	require.NoError(t, registry.allow("a.example.com"))
+	registry.record("a.example.com", true)
+
+	assert.Equal(t, BreakerOpen, registry.State("a.example.com"))
+	assert.Equal(t, BreakerClosed, registry.State("b.example.com"))
+	assert.NoError(t, registry.allow("b.example.com"))
+
+	registry.Reset("a.example.com")
+	assert.Equal(t, BreakerClosed, registry.State("a.example.com"))
+}
+
+func TestCircuitBreakerHalfOpenRetryAt(t *testing.T) {
+	now := time.Now()
+	registry := NewBreakerRegistry(BreakerOptions{MinRequests: 1, OpenTimeout: time.Minute})
+	registry.now = func() time.Time { return now }
+
+	require.NoError(t, registry.allow("a.example.com"))
+	registry.record("a.example.com", true)
+
+	// The probe is in flight, the next request is rejected without a retry
+	// time
+	now = now.Add(time.Minute)
+	require.NoError(t, registry.allow("a.example.com"))
+
+	err := registry.allow("a.example.com")
+	var openErr *CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.True(t, openErr.RetryAt.IsZero())
+	assert.Contains(t, openErr.Error(), "probing")
+}
@@ -51,8 +51,8 @@ type Authorization struct {
 // The name of the attributes should be self descriptive but there are some
 // mentions to be made.
 //
-// `Method` should not be set directly. It will be set by the HTTP verb
-// methods: Get, Post, etc.
+// `Method` is set by the HTTP verb methods: Get, Post, etc. It only needs to
+// be set directly when sending the request with Do.
 //
 // `Authorization` is the preferred way for setting the request's Authorization
 // header and if the authorization details are specified both using the Headers
@@ -112,6 +112,16 @@ func (request *Request) Delete(ctx context.Context) (*Response, error) {
 	return request.httpWithMiddleware(ctx)
 }
 
+// Send an HTTP request using the method set in the request, or GET if the
+// method is not set. The context can be used to set a timeout or cancel the
+// request.
+func (request *Request) Do(ctx context.Context) (*Response, error) {
+	if request.Method == "" {
+		request.Method = "GET"
+	}
+	return request.httpWithMiddleware(ctx)
+}
+
 // Wraps the request making `http` method with the available middlewares and
 // starts the execution chain.
 func (request *Request) httpWithMiddleware(ctx context.Context) (*Response, error) {
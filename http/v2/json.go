@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnexpectedStatus is wrapped by a ResponseError when the response
+	// status code is not 2xx.
+	ErrUnexpectedStatus = errors.New("unexpected status code")
+	// ErrUnexpectedContentType is wrapped by a ResponseError when the response
+	// does not have a JSON content type.
+	ErrUnexpectedContentType = errors.New("unexpected content type")
+)
+
+// Maximum number of bytes of the response body kept in a ResponseError
+const maxErrorBodySize = 512
+
+// ResponseError is returned by DecodeJSON and DoJSON when a response cannot
+// be decoded. Body holds the beginning of the response payload, which is
+// usually enough to find out what went wrong.
+type ResponseError struct {
+	StatusCode  int
+	ContentType string
+	Body        string
+	Err         error
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s (status: %d, content type: %q): %s", e.Err.Error(), e.StatusCode, e.ContentType, e.Body)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeJSON unmarshals the response payload into a value of type T. The
+// response must have a 2xx status code and a JSON content type, otherwise a
+// *ResponseError is returned. An empty payload, such as the one of a 204
+// response, decodes into the zero value of T.
+func DecodeJSON[T any](response *Response) (T, error) {
+	var ret T
+
+	contentType := response.Header.Get("Content-Type")
+
+	newError := func(err error) *ResponseError {
+		return &ResponseError{
+			StatusCode:  response.StatusCode,
+			ContentType: contentType,
+			Body:        truncate(response.Payload),
+			Err:         err,
+		}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return ret, newError(ErrUnexpectedStatus)
+	}
+
+	if response.StatusCode == http.StatusNoContent || len(response.Payload) == 0 {
+		return ret, nil
+	}
+
+	if !isJSON(contentType) {
+		return ret, newError(ErrUnexpectedContentType)
+	}
+
+	if err := json.Unmarshal(response.Payload, &ret); err != nil {
+		return ret, newError(fmt.Errorf("while unmarshalling response: %w", err))
+	}
+
+	return ret, nil
+}
+
+// DoJSON sends the request, see Do, and decodes the response with DecodeJSON.
+func DoJSON[T any](ctx context.Context, request *Request) (T, error) {
+	response, err := request.Do(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return DecodeJSON[T](response)
+}
+
+// Returns true for application/json and any +json media type such as
+// application/problem+json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func truncate(payload []byte) string {
+	if len(payload) > maxErrorBodySize {
+		return string(payload[:maxErrorBodySize]) + "..."
+	}
+	return string(payload)
+}
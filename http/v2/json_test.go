@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoJSON(t *testing.T) {
+
+	type thing struct {
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        thing
+		wantErr     error
+	}{
+		{
+			name:        "OK",
+			status:      200,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"9spokes"}`,
+			want:        thing{Name: "9spokes"},
+		},
+		{
+			name:        "Vendor JSON media type",
+			status:      201,
+			contentType: "application/vnd.api+json",
+			body:        `{"name":"9spokes"}`,
+			want:        thing{Name: "9spokes"},
+		},
+		{
+			name:   "No content",
+			status: 204,
+		},
+		{
+			name:        "Server error",
+			status:      500,
+			contentType: "application/json",
+			body:        `{"name":"9spokes"}`,
+			wantErr:     ErrUnexpectedStatus,
+		},
+		{
+			name:        "HTML body",
+			status:      200,
+			contentType: "text/html",
+			body:        "<html></html>",
+			wantErr:     ErrUnexpectedContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal("PUT", r.Method)
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			got, err := DoJSON[thing](context.Background(), &Request{URL: ts.URL, Method: "PUT"})
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.True(errors.Is(err, tt.wantErr))
+
+				var responseErr *ResponseError
+				require.True(errors.As(err, &responseErr))
+				assert.Equal(tt.status, responseErr.StatusCode)
+				assert.Equal(tt.body, responseErr.Body)
+				return
+			}
+
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestDecodeJSONInvalidPayload(t *testing.T) {
+	response := &Response{
+		Response: &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+		},
+		Payload: []byte("{"),
+	}
+
+	_, err := DecodeJSON[map[string]interface{}](response)
+
+	var responseErr *ResponseError
+	require.True(t, errors.As(err, &responseErr))
+	assert.Equal(t, "{", responseErr.Body)
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"math/big"
 	"os"
+	"sync"
 
 	"github.com/9spokes/go/logging/v3"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -29,7 +30,9 @@ type KeyVault struct {
 	// Unfortunately, Azure Key Vault cannot store certificates so we'll need
 	// use a local file instead.
 	CertificateFile string
-	client          *azkeys.Client
+
+	mu     sync.Mutex
+	client *azkeys.Client
 }
 
 func (kv *KeyVault) Get() (tls.Certificate, error) {
@@ -37,8 +40,7 @@ func (kv *KeyVault) Get() (tls.Certificate, error) {
 		return tls.Certificate{}, err
 	}
 
-	err := kv.connectToKeyVault()
-	if err != nil {
+	if err := kv.connect(); err != nil {
 		return tls.Certificate{}, err
 	}
 
@@ -119,6 +121,10 @@ func (ctx *KeyVault) connectToKeyVault() error {
 }
 
 func (kv *KeyVault) Public() crypto.PublicKey {
+	if err := kv.connect(); err != nil {
+		logging.Errorf("Failed to connect to Key Vault: %s", err.Error())
+		return nil
+	}
 
 	keyBundle, err := kv.client.GetKey(context.Background(), kv.Key, kv.KeyVersion, nil)
 	if err != nil {
@@ -143,6 +149,10 @@ func (kv *KeyVault) Public() crypto.PublicKey {
 }
 
 func (kv *KeyVault) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := kv.connect(); err != nil {
+		return nil, err
+	}
+
 	params := azkeys.SignParameters{
 		Value: digest,
 	}
@@ -190,3 +200,99 @@ func (kv *KeyVault) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]
 
 	return res.Result, nil
 }
+
+// WrapKey encrypts a data key with RSA-OAEP-256, so the KeyVault can be used
+// as a crypto.KeyProvider. The version of the key, even when KeyVersion is
+// empty, is stored with the wrapped key so it can still be unwrapped once the
+// key has been rotated.
+func (kv *KeyVault) WrapKey(key []byte) ([]byte, error) {
+	if err := kv.connect(); err != nil {
+		return nil, err
+	}
+
+	algo := azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256
+	params := azkeys.KeyOperationsParameters{
+		Algorithm: &algo,
+		Value:     key,
+	}
+
+	res, err := kv.client.WrapKey(context.Background(), kv.Key, kv.KeyVersion, params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while wrapping key: %w", err)
+	}
+
+	version, err := wrappingKeyVersion(res.KID, kv.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := append([]byte{byte(len(version))}, version...)
+	return append(wrapped, res.Result...), nil
+}
+
+// Returns the concrete version of the key which wrapped a data key, taken from
+// the key ID returned by Key Vault as KeyVersion may be empty, meaning the
+// latest version
+func wrappingKeyVersion(kid *azkeys.ID, keyVersion string) (string, error) {
+	version := keyVersion
+	if kid != nil && kid.Version() != "" {
+		version = kid.Version()
+	}
+
+	if version == "" {
+		return "", fmt.Errorf("could not determine the version of the wrapping key")
+	}
+
+	if len(version) > 255 {
+		return "", fmt.Errorf("key version too long")
+	}
+
+	return version, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey.
+func (kv *KeyVault) UnwrapKey(wrapped []byte) ([]byte, error) {
+	if len(wrapped) == 0 || len(wrapped) <= 1+int(wrapped[0]) {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+
+	if err := kv.connect(); err != nil {
+		return nil, err
+	}
+
+	version := string(wrapped[1 : 1+wrapped[0]])
+
+	algo := azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256
+	params := azkeys.KeyOperationsParameters{
+		Algorithm: &algo,
+		Value:     wrapped[1+wrapped[0]:],
+	}
+
+	res, err := kv.client.UnwrapKey(context.Background(), kv.Key, version, params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while unwrapping key: %w", err)
+	}
+
+	return res.Result, nil
+}
+
+// Connects to the Key Vault unless already done, the KeyVault being used
+// concurrently once returned by Get or as a crypto.KeyProvider
+func (kv *KeyVault) connect() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.client != nil {
+		return nil
+	}
+
+	if kv.HSMName == "" {
+		return fmt.Errorf("HSM name not specified")
+	}
+
+	if kv.Key == "" {
+		return fmt.Errorf("key name not specified")
+	}
+
+	return kv.connectToKeyVault()
+}
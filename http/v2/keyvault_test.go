@@ -0,0 +1,43 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_wrappingKeyVersion(t *testing.T) {
+	kid := azkeys.ID("https://hsm.managedhsm.azure.net/keys/kek/0123456789abcdef")
+	unversioned := azkeys.ID("https://hsm.managedhsm.azure.net/keys/kek")
+
+	version, err := wrappingKeyVersion(&kid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", version)
+
+	version, err = wrappingKeyVersion(&kid, "0123456789abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", version)
+
+	version, err = wrappingKeyVersion(&unversioned, "fedcba9876543210")
+	assert.NoError(t, err)
+	assert.Equal(t, "fedcba9876543210", version)
+
+	_, err = wrappingKeyVersion(&unversioned, "")
+	assert.Error(t, err)
+
+	_, err = wrappingKeyVersion(nil, "")
+	assert.Error(t, err)
+}
+
+func TestKeyVaultNotConnected(t *testing.T) {
+	kv := &KeyVault{}
+
+	assert.Nil(t, kv.Public())
+
+	_, err := kv.Sign(nil, make([]byte, 32), nil)
+	assert.Error(t, err)
+
+	_, err = kv.WrapKey(make([]byte, 32))
+	assert.Error(t, err)
+}
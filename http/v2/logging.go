@@ -0,0 +1,263 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/9spokes/go/logging/v3"
+)
+
+// Replaces the value of any redacted header, field or query parameter
+const redacted = "[REDACTED]"
+
+// Headers which are always redacted
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// JSON fields, form fields and query parameters which are always redacted
+var sensitiveFields = []string{
+	"client_secret",
+	"refresh_token",
+	"access_token",
+	"id_token",
+	"password",
+	"code_verifier",
+}
+
+// LoggingOptions controls what the Logger middleware logs and at which level.
+// The levels are the ones declared in the logging package, LevelDebug being
+// the zero value; DefaultLoggingOptions is a good starting point.
+type LoggingOptions struct {
+	// Level used for responses with a status code lower than 400.
+	SuccessLevel int
+	// Level used for responses with a 4xx status code.
+	ClientErrorLevel int
+	// Level used for responses with a 5xx status code and failed requests.
+	ServerErrorLevel int
+	// Log the request and response headers.
+	DumpHeaders bool
+	// Log the request and response bodies, truncated to MaxBodySize bytes.
+	DumpBodies bool
+	// Maximum number of bytes of a body that are logged, 1024 if not set.
+	MaxBodySize int
+	// Additional headers to be redacted.
+	RedactHeaders []string
+	// Additional JSON fields, form fields and query parameters to be
+	// redacted. The authorization headers, client secrets, passwords and
+	// OAuth tokens are always redacted.
+	RedactFields []string
+}
+
+// DefaultLoggingOptions logs successful requests at debug level, client errors
+// as warnings and server errors as errors, without dumping headers or bodies.
+var DefaultLoggingOptions = LoggingOptions{
+	SuccessLevel:     logging.LevelDebug,
+	ClientErrorLevel: logging.LevelWarning,
+	ServerErrorLevel: logging.LevelError,
+	MaxBodySize:      1024,
+}
+
+// Logger returns a middleware logging the method, URL, status code, duration
+// and request and response sizes of every request. Secrets are redacted from
+// the logged URL, headers and bodies.
+//
+// When combined with the Retry middleware, adding the logger after Retry logs
+// every attempt individually.
+func Logger(opts LoggingOptions) MiddlewareFunc {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultLoggingOptions.MaxBodySize
+	}
+
+	r := newRedactor(opts)
+
+	return func(next Middleware) Middleware {
+		return func(ctx context.Context, request *Request) (*Response, error) {
+
+			// Snapshot the request as the next middlewares may modify it
+			method := request.Method
+			link := r.url(request.URL, request.Query)
+			sent := len(request.Body)
+
+			var dump strings.Builder
+			if opts.DumpHeaders {
+				fmt.Fprintf(&dump, "\n> Headers: %s", r.requestHeaders(request))
+			}
+			if opts.DumpBodies && sent > 0 {
+				fmt.Fprintf(&dump, "\n> Body: %s", r.body(request.Body, opts.MaxBodySize))
+			}
+
+			start := time.Now()
+			response, err := next(ctx, request)
+			elapsed := time.Since(start)
+
+			if err != nil {
+				log(opts.ServerErrorLevel, "%s %s failed after %s (sent %d bytes): %s%s", method, link, elapsed, sent, err.Error(), dump.String())
+				return response, err
+			}
+
+			level := opts.SuccessLevel
+			switch {
+			case response.StatusCode >= 500:
+				level = opts.ServerErrorLevel
+			case response.StatusCode >= 400:
+				level = opts.ClientErrorLevel
+			}
+
+			if opts.DumpHeaders {
+				headers := make(map[string]string, len(response.Header))
+				for k := range response.Header {
+					headers[k] = response.Header.Get(k)
+				}
+				fmt.Fprintf(&dump, "\n< Headers: %s", r.headers(headers))
+			}
+			if opts.DumpBodies && len(response.Payload) > 0 {
+				fmt.Fprintf(&dump, "\n< Body: %s", r.body(response.Payload, opts.MaxBodySize))
+			}
+
+			log(level, "%s %s %d in %s (sent %d bytes, received %d bytes)%s", method, link, response.StatusCode, elapsed, sent, len(response.Payload), dump.String())
+
+			return response, err
+		}
+	}
+}
+
+// Logs a message at the specified level. Fatal messages are logged as errors
+// since a failed request should never stop the process.
+func log(level int, format string, args ...interface{}) {
+	switch level {
+	case logging.LevelDebug:
+		logging.Debugf(format, args...)
+	case logging.LevelInfo:
+		logging.Infof(format, args...)
+	case logging.LevelWarning:
+		logging.Warningf(format, args...)
+	default:
+		logging.Errorf(format, args...)
+	}
+}
+
+// Redacts sensitive values from URLs, headers and bodies.
+type redactor struct {
+	sensitiveHeaders map[string]bool
+	sensitiveFields  map[string]bool
+}
+
+func newRedactor(opts LoggingOptions) *redactor {
+	r := &redactor{
+		sensitiveHeaders: make(map[string]bool),
+		sensitiveFields:  make(map[string]bool),
+	}
+	for _, h := range append(sensitiveHeaders, opts.RedactHeaders...) {
+		r.sensitiveHeaders[strings.ToLower(h)] = true
+	}
+	for _, f := range append(sensitiveFields, opts.RedactFields...) {
+		r.sensitiveFields[strings.ToLower(f)] = true
+	}
+	return r
+}
+
+// Returns the URL, including the request query parameters, with sensitive
+// query parameters redacted.
+func (r *redactor) url(rawURL string, query map[string]string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	for k, v := range query {
+		q.Add(k, v)
+	}
+	r.values(q)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Returns the request headers as they will be sent, including the ones set
+// from the Authorization attribute.
+func (r *redactor) requestHeaders(request *Request) string {
+	headers := make(map[string]string, len(request.Headers)+1)
+	for k, v := range request.Headers {
+		headers[k] = v
+	}
+	if request.Authorization.Scheme != "" {
+		headers["Authorization"] = request.Authorization.Scheme
+	}
+	return r.headers(headers)
+}
+
+func (r *redactor) headers(headers map[string]string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := headers[k]
+		if r.sensitiveHeaders[strings.ToLower(k)] {
+			v = redacted
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", k, v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Redacts sensitive fields from JSON and form encoded bodies and truncates
+// the result to max bytes. Any other body is only truncated.
+func (r *redactor) body(body []byte, max int) string {
+	var s string
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err == nil {
+		b, _ := json.Marshal(r.json(doc))
+		s = string(b)
+	} else if values, err := url.ParseQuery(string(body)); err == nil && strings.Contains(string(body), "=") {
+		r.values(values)
+		s = values.Encode()
+	} else {
+		s = string(body)
+	}
+
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
+
+func (r *redactor) json(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if r.sensitiveFields[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = r.json(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = r.json(e)
+		}
+	}
+	return doc
+}
+
+func (r *redactor) values(values url.Values) {
+	for k := range values {
+		if r.sensitiveFields[strings.ToLower(k)] {
+			values[k] = []string{redacted}
+		}
+	}
+}
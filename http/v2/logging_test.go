@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"secret"}`))
+	}))
+	defer ts.Close()
+
+	opts := DefaultLoggingOptions
+	opts.DumpHeaders = true
+	opts.DumpBodies = true
+
+	request := Request{URL: ts.URL, Body: []byte("password=secret")}
+	request.Use(Logger(opts))
+
+	response, err := request.Post(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, `{"access_token":"secret"}`, string(response.Payload), "response must not be modified")
+	assert.Equal(t, "password=secret", string(request.Body), "request must not be modified")
+}
+
+func Test_redactor(t *testing.T) {
+	r := newRedactor(LoggingOptions{
+		RedactHeaders: []string{"X-Api-Key"},
+		RedactFields:  []string{"pin"},
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		got := r.url("https://example.com/token?code=abc&client_secret=xyz", map[string]string{"refresh_token": "123"})
+		assert.Equal(t, "https://example.com/token?client_secret=%5BREDACTED%5D&code=abc&refresh_token=%5BREDACTED%5D", got)
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		got := r.headers(map[string]string{
+			"authorization": "Bearer abc",
+			"X-Api-Key":     "xyz",
+			"Accept":        "application/json",
+		})
+		assert.Equal(t, "Accept: application/json, X-Api-Key: [REDACTED], authorization: [REDACTED]", got)
+	})
+
+	t.Run("Authorization attribute", func(t *testing.T) {
+		got := r.requestHeaders(&Request{Authorization: Authorization{Scheme: "basic", Username: "user", Password: "secret"}})
+		assert.Equal(t, "Authorization: [REDACTED]", got)
+	})
+
+	t.Run("JSON body", func(t *testing.T) {
+		got := r.body([]byte(`{"user":{"Password":"secret","pin":1234},"tokens":[{"id_token":"abc"}]}`), 1024)
+		assert.Equal(t, `{"tokens":[{"id_token":"[REDACTED]"}],"user":{"Password":"[REDACTED]","pin":"[REDACTED]"}}`, got)
+	})
+
+	t.Run("Form body", func(t *testing.T) {
+		got := r.body([]byte("grant_type=refresh_token&refresh_token=abc"), 1024)
+		assert.Equal(t, "grant_type=refresh_token&refresh_token=%5BREDACTED%5D", got)
+	})
+
+	t.Run("Truncated body", func(t *testing.T) {
+		got := r.body([]byte("plain text body"), 5)
+		assert.Equal(t, "plain...", got)
+	})
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryOptions controls the behaviour of the Retry middleware. Zero values are
+// replaced with sensible defaults, see DefaultRetryOptions.
+type RetryOptions struct {
+	// Maximum number of attempts, including the first one.
+	MaxAttempts int
+	// Delay before the first retry.
+	InitialInterval time.Duration
+	// Upper bound for the delay between two attempts.
+	MaxInterval time.Duration
+	// Factor by which the delay grows after every attempt.
+	Multiplier float64
+	// Randomisation factor applied to every delay. A value of 0.5 means the
+	// delay will be picked randomly between 50% and 150% of its nominal value.
+	Jitter float64
+	// Maximum time spent retrying, measured from the first attempt. No new
+	// attempt is started once this budget would be exceeded.
+	MaxElapsedTime time.Duration
+	// Optional predicate deciding whether an attempt should be retried. When
+	// not set, network errors, 429 and 5xx responses are retried.
+	ShouldRetry func(*Response, error) bool
+}
+
+// DefaultRetryOptions are the options used for any RetryOptions attribute
+// which has not been set.
+var DefaultRetryOptions = RetryOptions{
+	MaxAttempts:     3,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+	MaxElapsedTime:  2 * time.Minute,
+}
+
+// Retry returns a middleware that retries failed requests using an exponential
+// backoff strategy with jitter. If the server replies with a Retry-After header
+// the specified delay is honoured instead, as long as it fits in the
+// remaining time budget.
+//
+// The request body is restored before every attempt so that middlewares
+// further down the chain always see the original payload.
+//
+// When all attempts are exhausted the outcome of the last attempt is returned
+// as is, which means a 5xx response is not converted to an error.
+func Retry(opts RetryOptions) MiddlewareFunc {
+	opts = opts.withDefaults()
+
+	return func(next Middleware) Middleware {
+		return func(ctx context.Context, request *Request) (*Response, error) {
+			body := request.Body
+			start := time.Now()
+
+			var response *Response
+			var err error
+
+			for attempt := 1; ; attempt++ {
+				request.Body = body
+				response, err = next(ctx, request)
+
+				if attempt >= opts.MaxAttempts || !opts.ShouldRetry(response, err) {
+					return response, err
+				}
+
+				delay := opts.backoff(attempt)
+				if after, ok := retryAfter(response); ok {
+					delay = after
+				}
+
+				if time.Since(start)+delay > opts.MaxElapsedTime {
+					return response, err
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return response, err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+func (opts RetryOptions) withDefaults() RetryOptions {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultRetryOptions.MaxAttempts
+	}
+	if opts.InitialInterval <= 0 {
+		opts.InitialInterval = DefaultRetryOptions.InitialInterval
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = DefaultRetryOptions.MaxInterval
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = DefaultRetryOptions.Multiplier
+	}
+	if opts.Jitter <= 0 || opts.Jitter > 1 {
+		opts.Jitter = DefaultRetryOptions.Jitter
+	}
+	if opts.MaxElapsedTime <= 0 {
+		opts.MaxElapsedTime = DefaultRetryOptions.MaxElapsedTime
+	}
+	if opts.ShouldRetry == nil {
+		opts.ShouldRetry = IsRetryable
+	}
+	return opts
+}
+
+// Computes the delay that should precede the retry following the specified
+// attempt.
+func (opts RetryOptions) backoff(attempt int) time.Duration {
+	delay := float64(opts.InitialInterval) * math.Pow(opts.Multiplier, float64(attempt-1))
+	if delay > float64(opts.MaxInterval) {
+		delay = float64(opts.MaxInterval)
+	}
+
+	if opts.Jitter > 0 {
+		delta := opts.Jitter * delay
+		delay = delay - delta + rand.Float64()*2*delta
+	}
+
+	return time.Duration(delay)
+}
+
+// IsRetryable reports whether an attempt failed with a transient error: a
+// network error, a 429 Too Many Requests or any 5xx response. Errors caused by
+// the request context being cancelled or timing out are not retryable, nor
+// are permanent failures such as unsupported schemes or unknown hosts.
+func IsRetryable(response *Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			return false
+		}
+
+		return isTransient(urlErr.Err)
+	}
+
+	if response == nil || response.Response == nil {
+		return false
+	}
+
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// Reports whether the error wrapped by a url.Error is a timeout or a network
+// error, e.g. a refused or reset connection
+func isTransient(err error) bool {
+	// The connection was closed before a response was received
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Parses the Retry-After header, which can be either a number of seconds or
+// an HTTP date.
+func retryAfter(response *Response) (time.Duration, bool) {
+	if response == nil || response.Response == nil {
+		return 0, false
+	}
+
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
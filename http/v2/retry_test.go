@@ -0,0 +1,188 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+
+	opts := RetryOptions{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		opts       RetryOptions
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			name:       "Success on first attempt",
+			statuses:   []int{200},
+			opts:       opts,
+			wantStatus: 200,
+			wantCalls:  1,
+		},
+		{
+			name:       "Success after server errors",
+			statuses:   []int{503, 500, 200},
+			opts:       opts,
+			wantStatus: 200,
+			wantCalls:  3,
+		},
+		{
+			name:       "Too many requests is retried",
+			statuses:   []int{429, 200},
+			opts:       opts,
+			wantStatus: 200,
+			wantCalls:  2,
+		},
+		{
+			name:       "Client errors are not retried",
+			statuses:   []int{404, 200},
+			opts:       opts,
+			wantStatus: 404,
+			wantCalls:  1,
+		},
+		{
+			name:       "Attempts exhausted",
+			statuses:   []int{502, 502, 502, 200},
+			opts:       opts,
+			wantStatus: 502,
+			wantCalls:  3,
+		},
+		{
+			name:       "Retry-After beyond time budget",
+			statuses:   []int{503, 200},
+			retryAfter: "120",
+			opts: RetryOptions{
+				MaxAttempts:     3,
+				InitialInterval: time.Millisecond,
+				MaxElapsedTime:  time.Second,
+			},
+			wantStatus: 503,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			calls := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal("payload", string(body), "body not rewound")
+
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer ts.Close()
+
+			request := Request{URL: ts.URL, Body: []byte("payload")}
+			request.Use(Retry(tt.opts))
+			// Consume the body to make sure the retry middleware restores it
+			request.Use(func(next Middleware) Middleware {
+				return func(ctx context.Context, r *Request) (*Response, error) {
+					response, err := next(ctx, r)
+					r.Body = nil
+					return response, err
+				}
+			})
+
+			response, err := request.Post(context.Background())
+			require.NoError(err)
+			assert.Equal(tt.wantStatus, response.StatusCode)
+			assert.Equal(tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	request := Request{URL: url}
+	request.Use(Retry(RetryOptions{MaxAttempts: 2, InitialInterval: time.Millisecond}))
+
+	_, err := request.Get(context.Background())
+	assert.Error(t, err)
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "Missing", header: "", ok: false},
+		{name: "Seconds", header: "3", want: 3 * time.Second, ok: true},
+		{name: "Date in the past", header: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, ok: true},
+		{name: "Invalid", header: "soon", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("Retry-After", tt.header)
+			}
+
+			got, ok := retryAfter(&Response{Response: &http.Response{Header: header}})
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed := ts.URL
+	ts.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{name: "Connection refused", url: closed, want: true},
+		{name: "Unsupported scheme", url: "ftp://example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			require.NoError(t, err)
+
+			_, err = http.DefaultClient.Do(request)
+			require.Error(t, err)
+			assert.Equal(t, tt.want, IsRetryable(nil, err))
+		})
+	}
+
+	assert.False(t, IsRetryable(nil, io.EOF))
+	assert.True(t, IsRetryable(nil, &url.Error{Op: "Get", URL: "http://example.com", Err: io.EOF}))
+	assert.False(t, IsRetryable(nil, &url.Error{Op: "Get", URL: "http://example.com", Err: context.Canceled}))
+	assert.False(t, IsRetryable(nil, &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "example.com", IsNotFound: true}}}))
+	assert.True(t, IsRetryable(nil, &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "example.com", IsTimeout: true}}}))
+}
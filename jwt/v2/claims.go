@@ -0,0 +1,234 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Reasons a token is rejected by ValidateWithOptions, wrapped in a ClaimError
+var (
+	ErrMissingClaim    = errors.New("missing claim")
+	ErrInvalidIssuer   = errors.New("invalid issuer")
+	ErrInvalidAudience = errors.New("invalid audience")
+	ErrExpired         = errors.New("token is expired")
+	ErrNotValidYet     = errors.New("token is not valid yet")
+	ErrIssuedInFuture  = errors.New("token used before issued")
+	ErrTooOld          = errors.New("token is too old")
+	ErrInvalidClaim    = errors.New("invalid claim")
+)
+
+// ClaimError is returned when a claim fails validation. Err is one of the
+// errors above and can be checked with errors.Is.
+type ClaimError struct {
+	Claim string
+	Err   error
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Claim)
+}
+
+func (e *ClaimError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateOptions holds the checks performed on the claims of a token by
+// ValidateWithOptions. The exp, nbf and iat claims are always checked when
+// present.
+type ValidateOptions struct {
+	// The iss claim must be one of these, not checked if empty
+	Issuers []string
+	// One of the values of the aud claim must be one of these, not checked if
+	// empty
+	Audiences []string
+	// Claims which must be present, e.g. exp or sub
+	RequiredClaims []string
+	// Tolerated clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+	// Maximum time since the token was issued, not checked if 0. The iat
+	// claim is required when set.
+	MaxAge time.Duration
+	// Custom checks of the value of a claim, the claim is required
+	Predicates map[string]func(value interface{}) bool
+}
+
+// ValidateWithOptions checks the signature, decrypts if necessary and verifies
+// the claims against the options. Returns the token claims if everything is
+// ok, or a ClaimError describing the first failed check.
+func (ctx *Context) ValidateWithOptions(input string, opts ValidateOptions) (map[string]interface{}, error) {
+
+	token, err := ctx.validate(input, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+// Parses and verifies the token, returning it so the caller can perform
+// further checks on the header
+func (ctx *Context) validate(input string, opts ValidateOptions) (*jwt.Token, error) {
+
+	if len(strings.Split(input, ".")) == 5 {
+		decrypted, err := ctx.decrypt(input)
+		if err != nil {
+			return nil, fmt.Errorf("while decrypting token: %s", err.Error())
+		}
+
+		input = decrypted
+	}
+
+	// The time based claims are checked below with leeway
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(input, func(token *jwt.Token) (interface{}, error) {
+		return ctx.getSigningKey(token)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while parsing token: %w", err)
+	}
+
+	if err := checkClaims(token.Claims.(jwt.MapClaims), opts, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Verifies the claims against the options at the specified time
+func checkClaims(claims jwt.MapClaims, opts ValidateOptions, now time.Time) error {
+
+	for _, name := range opts.RequiredClaims {
+		if _, ok := claims[name]; !ok {
+			return &ClaimError{Claim: name, Err: ErrMissingClaim}
+		}
+	}
+
+	if len(opts.Issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !contains(opts.Issuers, iss) {
+			return &ClaimError{Claim: "iss", Err: ErrInvalidIssuer}
+		}
+	}
+
+	if len(opts.Audiences) > 0 {
+		found := false
+		for _, aud := range audience(claims) {
+			if contains(opts.Audiences, aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ClaimError{Claim: "aud", Err: ErrInvalidAudience}
+		}
+	}
+
+	if exp, ok, err := timeClaim(claims, "exp"); err != nil {
+		return err
+	} else if ok && now.After(exp.Add(opts.Leeway)) {
+		return &ClaimError{Claim: "exp", Err: ErrExpired}
+	}
+
+	if nbf, ok, err := timeClaim(claims, "nbf"); err != nil {
+		return err
+	} else if ok && nbf.After(now.Add(opts.Leeway)) {
+		return &ClaimError{Claim: "nbf", Err: ErrNotValidYet}
+	}
+
+	iat, ok, err := timeClaim(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && iat.After(now.Add(opts.Leeway)) {
+		return &ClaimError{Claim: "iat", Err: ErrIssuedInFuture}
+	}
+
+	if opts.MaxAge > 0 {
+		if !ok {
+			return &ClaimError{Claim: "iat", Err: ErrMissingClaim}
+		}
+		if now.Sub(iat) > opts.MaxAge+opts.Leeway {
+			return &ClaimError{Claim: "iat", Err: ErrTooOld}
+		}
+	}
+
+	// Sorted so the same token always fails on the same claim
+	names := make([]string, 0, len(opts.Predicates))
+	for name := range opts.Predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := claims[name]
+		if !ok {
+			return &ClaimError{Claim: name, Err: ErrMissingClaim}
+		}
+		if !opts.Predicates[name](value) {
+			return &ClaimError{Claim: name, Err: ErrInvalidClaim}
+		}
+	}
+
+	return nil
+}
+
+// Returns the value of a NumericDate claim, whether it is present, and an
+// error if it is present but not a number
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	t, ok := numericDate(value)
+	if !ok {
+		return time.Time{}, false, &ClaimError{Claim: name, Err: ErrInvalidClaim}
+	}
+
+	return t, true, nil
+}
+
+// Returns the aud claim as a list, whether it is a single string or an array
+func audience(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		ret := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a NumericDate claim, as decoded from JSON, to a time
+func numericDate(claim interface{}) (time.Time, bool) {
+	switch v := claim.(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
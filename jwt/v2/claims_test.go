@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkClaims(t *testing.T) {
+
+	now := time.Unix(1700000000, 0)
+	claims := jwt.MapClaims{
+		"iss":   "https://issuer.example.com",
+		"aud":   []interface{}{"api", "other"},
+		"sub":   "123",
+		"exp":   float64(now.Unix() + 60),
+		"nbf":   float64(now.Unix() - 60),
+		"iat":   float64(now.Unix() - 60),
+		"scope": "read write",
+	}
+
+	tests := []struct {
+		name  string
+		opts  ValidateOptions
+		now   time.Time
+		err   error
+		claim string
+	}{
+		{
+			name: "Valid token",
+			opts: ValidateOptions{
+				Issuers:        []string{"https://other.example.com", "https://issuer.example.com"},
+				Audiences:      []string{"api"},
+				RequiredClaims: []string{"sub", "exp"},
+				MaxAge:         time.Hour,
+				Predicates: map[string]func(interface{}) bool{
+					"scope": func(v interface{}) bool { return v == "read write" },
+				},
+			},
+			now: now,
+		},
+		{
+			name:  "Missing claim",
+			opts:  ValidateOptions{RequiredClaims: []string{"email"}},
+			now:   now,
+			err:   ErrMissingClaim,
+			claim: "email",
+		},
+		{
+			name:  "Wrong issuer",
+			opts:  ValidateOptions{Issuers: []string{"https://other.example.com"}},
+			now:   now,
+			err:   ErrInvalidIssuer,
+			claim: "iss",
+		},
+		{
+			name:  "Wrong audience",
+			opts:  ValidateOptions{Audiences: []string{"web"}},
+			now:   now,
+			err:   ErrInvalidAudience,
+			claim: "aud",
+		},
+		{
+			name:  "Expired",
+			now:   now.Add(2 * time.Minute),
+			err:   ErrExpired,
+			claim: "exp",
+		},
+		{
+			name: "Expired within leeway",
+			opts: ValidateOptions{Leeway: 2 * time.Minute},
+			now:  now.Add(2 * time.Minute),
+		},
+		{
+			name:  "Not valid yet",
+			now:   now.Add(-2 * time.Minute),
+			err:   ErrNotValidYet,
+			claim: "nbf",
+		},
+		{
+			name:  "Too old",
+			opts:  ValidateOptions{MaxAge: 30 * time.Second},
+			now:   now,
+			err:   ErrTooOld,
+			claim: "iat",
+		},
+		{
+			name: "Failed predicate",
+			opts: ValidateOptions{Predicates: map[string]func(interface{}) bool{
+				"scope": func(v interface{}) bool { return v == "admin" },
+			}},
+			now:   now,
+			err:   ErrInvalidClaim,
+			claim: "scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClaims(claims, tt.opts, tt.now)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, tt.err)
+			var claimErr *ClaimError
+			require.ErrorAs(t, err, &claimErr)
+			assert.Equal(t, tt.claim, claimErr.Claim)
+		})
+	}
+}
+
+func TestValidateWithOptions(t *testing.T) {
+	ts, sign := newTestProvider(t)
+	defer ts.Close()
+
+	ctx, err := NewFromDiscovery(ts.URL, "", "", "")
+	require.NoError(t, err)
+
+	token := sign(jwt.MapClaims{"iss": ts.URL, "sub": "123", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	_, err = ctx.ValidateWithOptions(token, ValidateOptions{Issuers: []string{ts.URL}})
+	assert.ErrorIs(t, err, ErrExpired)
+
+	got, err := ctx.ValidateWithOptions(token, ValidateOptions{Issuers: []string{ts.URL}, Leeway: 2 * time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "123", got["sub"])
+}
@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestSigningAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &rsaKey.PublicKey, KeyID: "rsa", Use: "sig"},
+			{Key: &p256Key.PublicKey, KeyID: "p256", Use: "sig"},
+			{Key: &p384Key.PublicKey, KeyID: "p384", Use: "sig"},
+			{Key: edPublicKey, KeyID: "ed25519", Use: "sig"},
+			{Key: []byte("secret"), KeyID: "hmac"},
+		}})
+	}))
+	defer ts.Close()
+
+	ctx, err := New(ts.URL, "", "", "")
+	require.NoError(t, err)
+	assert.NotContains(t, ctx.JWKS.Keys(), "hmac", "symmetric keys are skipped")
+
+	sign := func(method jwt.SigningMethod, kid string, key crypto.PrivateKey) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "123", "exp": time.Now().Add(time.Minute).Unix()})
+		token.Header[KID] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		algorithms []string
+		err        string
+	}{
+		{name: "RS256", token: sign(jwt.SigningMethodRS256, "rsa", rsaKey)},
+		{name: "PS256", token: sign(jwt.SigningMethodPS256, "rsa", rsaKey)},
+		{name: "ES256", token: sign(jwt.SigningMethodES256, "p256", p256Key)},
+		{name: "ES384", token: sign(jwt.SigningMethodES384, "p384", p384Key)},
+		{name: "EdDSA", token: sign(SigningMethodEdDSA, "ed25519", edKey)},
+		{
+			name:  "HMAC is not allowed by default",
+			token: sign(jwt.SigningMethodHS256, "hmac", []byte("secret")),
+			err:   "unexpected signing method",
+		},
+		{
+			name:       "Algorithm not in the allow-list",
+			token:      sign(jwt.SigningMethodES256, "p256", p256Key),
+			algorithms: []string{"PS256"},
+			err:        "unexpected signing method",
+		},
+		{
+			name:  "Key type not matching the algorithm",
+			token: sign(jwt.SigningMethodRS256, "p256", rsaKey),
+			err:   "cannot be used with signing method RS256",
+		},
+		{
+			name:  "Curve not matching the algorithm",
+			token: sign(jwt.SigningMethodES256, "p384", p256Key),
+			err:   "cannot be used with signing method ES256",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx.Algorithms = tt.algorithms
+
+			got, err := ctx.Validate(tt.token)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "123", got["sub"])
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package jwt
+
+import (
+	"crypto"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/9spokes/go/logging/v3"
+)
+
+const (
+	defaultJWKSMaxAge          = time.Hour
+	defaultJWKSRefreshInterval = time.Minute
+)
+
+// JWKSCache holds the keys of one or more JSON Web Key Sets. Each key set is
+// refreshed when it expires, as specified by the Cache-Control or Expires
+// headers of its response, and when an unknown key ID is looked up, at most
+// once per MinRefreshInterval. A key set which cannot be retrieved keeps its
+// previous keys and does not affect the others. It is safe for concurrent use.
+type JWKSCache struct {
+	// Optional HTTP client, a client with a 10 seconds timeout is used if not
+	// set
+	Client *http.Client
+	// How long a key set is cached for when its response does not say, 1 hour
+	// if not set
+	DefaultMaxAge time.Duration
+	// Minimum time between two fetches of the same key set, 1 minute if not
+	// set. This bounds the number of requests triggered by unknown key IDs.
+	MinRefreshInterval time.Duration
+
+	urls []string
+
+	mu   sync.RWMutex
+	sets map[string]*keySet
+	stop chan struct{}
+	done chan struct{}
+}
+
+type keySet struct {
+	keys    map[string]crypto.PublicKey
+	expiry  time.Time
+	fetched time.Time
+}
+
+// NewJWKSCache creates a cache for the space separated JWKS URLs. The keys are
+// retrieved on the first lookup, or by calling Refresh.
+func NewJWKSCache(jwksURLs string) *JWKSCache {
+
+	c := &JWKSCache{
+		urls: strings.Fields(jwksURLs),
+		sets: make(map[string]*keySet),
+	}
+
+	for _, u := range c.urls {
+		c.sets[u] = &keySet{}
+	}
+
+	return c
+}
+
+// Refresh retrieves all the key sets. An error is returned only if none of
+// them could be retrieved.
+func (c *JWKSCache) Refresh() error {
+
+	c.mu.Lock()
+	now := time.Now()
+	for _, set := range c.sets {
+		set.fetched = now
+	}
+	c.mu.Unlock()
+
+	var errs []string
+	for _, u := range c.urls {
+		if err := c.refresh(u); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(c.urls) {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Key returns the key with the specified ID. Expired key sets are refreshed
+// first and, if the key is not found, all the key sets which have not been
+// fetched within MinRefreshInterval.
+func (c *JWKSCache) Key(kid string) (crypto.PublicKey, bool) {
+
+	for _, u := range c.claim(false) {
+		c.refresh(u)
+	}
+
+	if key, ok := c.lookup(kid); ok {
+		return key, true
+	}
+
+	for _, u := range c.claim(true) {
+		c.refresh(u)
+	}
+
+	return c.lookup(kid)
+}
+
+// Keys returns all the keys currently held.
+func (c *JWKSCache) Keys() map[string]crypto.PublicKey {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make(map[string]crypto.PublicKey)
+	for i := len(c.urls) - 1; i >= 0; i-- {
+		for kid, key := range c.sets[c.urls[i]].keys {
+			ret[kid] = key
+		}
+	}
+
+	return ret
+}
+
+// Start refreshes the key sets in the background as they expire, until Stop is
+// called. A key set is refreshed at most MinRefreshInterval after it expires.
+func (c *JWKSCache) Start() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.stop, c.done = stop, done
+
+	go func() {
+		defer close(done)
+
+		for {
+			timer := time.NewTimer(c.nextRefresh())
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				for _, u := range c.claim(false) {
+					c.refresh(u)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the background refresh and waits for it to return.
+func (c *JWKSCache) Stop() {
+
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Fetches a key set and stores it, the previous keys are kept on failure
+func (c *JWKSCache) refresh(jwksURL string) error {
+
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	defaultMaxAge := c.DefaultMaxAge
+	if defaultMaxAge == 0 {
+		defaultMaxAge = defaultJWKSMaxAge
+	}
+
+	keys, ttl, err := fetchJWKS(client, jwksURL, defaultMaxAge)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set := c.sets[jwksURL]
+
+	if err != nil {
+		logging.Warningf("while retrieving web keys from '%s': %s", jwksURL, err.Error())
+		// Retry as soon as allowed
+		set.expiry = time.Now()
+		return err
+	}
+
+	set.keys = keys
+	set.expiry = time.Now().Add(ttl)
+
+	return nil
+}
+
+// Returns the URLs of the key sets which can be fetched, marking them as
+// fetched so concurrent callers don't fetch them again. Only the expired key
+// sets are returned unless all is true.
+func (c *JWKSCache) claim(all bool) []string {
+
+	now := time.Now()
+
+	// Most of the time nothing is due, which only needs the read lock
+	c.mu.RLock()
+	due := false
+	for _, set := range c.sets {
+		if c.isDue(set, now, all) {
+			due = true
+			break
+		}
+	}
+	c.mu.RUnlock()
+
+	if !due {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ret []string
+	for _, u := range c.urls {
+		if set := c.sets[u]; c.isDue(set, now, all) {
+			set.fetched = now
+			ret = append(ret, u)
+		}
+	}
+
+	return ret
+}
+
+func (c *JWKSCache) isDue(set *keySet, now time.Time, all bool) bool {
+	if now.Sub(set.fetched) < c.minRefreshInterval() {
+		return false
+	}
+	return all || !now.Before(set.expiry)
+}
+
+func (c *JWKSCache) lookup(kid string) (crypto.PublicKey, bool) {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, u := range c.urls {
+		if key, ok := c.sets[u].keys[kid]; ok {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the time until the next key set expires, no less than
+// MinRefreshInterval
+func (c *JWKSCache) nextRefresh() time.Duration {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var next time.Time
+	for _, set := range c.sets {
+		if next.IsZero() || set.expiry.Before(next) {
+			next = set.expiry
+		}
+	}
+
+	d := time.Until(next)
+	if d < c.minRefreshInterval() {
+		d = c.minRefreshInterval()
+	}
+
+	return d
+}
+
+func (c *JWKSCache) minRefreshInterval() time.Duration {
+	if c.MinRefreshInterval == 0 {
+		return defaultJWKSRefreshInterval
+	}
+	return c.MinRefreshInterval
+}
+
+// Returns how long a response can be cached for according to its Cache-Control
+// or Expires headers, or the default if they are not set
+func maxAge(header http.Header, defaultMaxAge time.Duration) time.Duration {
+
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+
+		if directive == "no-cache" || directive == "no-store" {
+			return 0
+		}
+
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	if header.Get("Expires") != "" {
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil || expires.Before(time.Now()) {
+			return 0
+		}
+		return time.Until(expires)
+	}
+
+	return defaultMaxAge
+}
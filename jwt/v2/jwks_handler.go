@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// PublishedKey is a key published by a JWKSHandler.
+type PublishedKey struct {
+	KeyID string
+	// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey. A private key or
+	// any crypto.Signer can also be used, only its public key is published.
+	Key crypto.PublicKey
+	// Optional signing algorithm the key is used with
+	Algorithm string
+	// Optional certificate chain of the key, published as x5c
+	Certificates []*x509.Certificate
+}
+
+// JWKSHandler is an http.Handler serving a JSON Web Key Set. The active keys
+// are the ones currently used to sign tokens. The retiring keys are no longer
+// used but still published until the tokens they signed have expired. The
+// response can be cached for MaxAge and has an ETag so clients can revalidate
+// it.
+type JWKSHandler struct {
+	// Sent as the max-age of the Cache-Control header, 1 hour if not set
+	MaxAge time.Duration
+
+	mu   sync.RWMutex
+	body []byte
+	etag string
+}
+
+// NewJWKSHandler creates a handler publishing the active and retiring keys.
+func NewJWKSHandler(active, retiring []PublishedKey) (*JWKSHandler, error) {
+
+	h := &JWKSHandler{}
+	if err := h.SetKeys(active, retiring); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// SetKeys replaces the published keys, e.g. when rotating them.
+func (h *JWKSHandler) SetKeys(active, retiring []PublishedKey) error {
+
+	var set jose.JSONWebKeySet
+	seen := make(map[string]bool)
+
+	for _, key := range append(append([]PublishedKey{}, active...), retiring...) {
+
+		if key.KeyID == "" {
+			return fmt.Errorf("missing key ID")
+		}
+		if seen[key.KeyID] {
+			return fmt.Errorf("duplicate key ID '%s'", key.KeyID)
+		}
+		seen[key.KeyID] = true
+
+		publicKey := key.Key
+		if signer, ok := publicKey.(crypto.Signer); ok {
+			publicKey = signer.Public()
+		}
+
+		switch publicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return fmt.Errorf("unsupported type %T for key '%s'", publicKey, key.KeyID)
+		}
+
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:          publicKey,
+			KeyID:        key.KeyID,
+			Algorithm:    key.Algorithm,
+			Use:          "sig",
+			Certificates: key.Certificates,
+		})
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("while marshalling key set: %s", err.Error())
+	}
+
+	sum := sha256.Sum256(body)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.body = body
+	h.etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	body, etag := h.body, h.etag
+	h.mu.RUnlock()
+
+	maxAge := h.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultJWKSMaxAge
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
+
+// Checks whether the If-None-Match header matches the ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+
+	handler, err := NewJWKSHandler(
+		[]PublishedKey{{KeyID: "current", Key: ecKey, Algorithm: "ES256"}},
+		[]PublishedKey{{KeyID: "previous", Key: &rsaKey.PublicKey}},
+	)
+	require.NoError(err)
+	handler.MaxAge = 10 * time.Minute
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	keys, ttl, err := fetchJWKS(http.DefaultClient, ts.URL, time.Hour)
+	require.NoError(err)
+	assert.Equal(10*time.Minute, ttl)
+	assert.Len(keys, 2)
+	assert.Equal(&ecKey.PublicKey, keys["current"])
+	assert.Equal(&rsaKey.PublicKey, keys["previous"])
+
+	response, err := http.Get(ts.URL)
+	require.NoError(err)
+	response.Body.Close()
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(etag)
+
+	// Private keys are never published
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotContains(recorder.Body.String(), `"d":`)
+
+	// Unchanged key set
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("If-None-Match", etag)
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusNotModified, recorder.Code)
+	assert.Empty(recorder.Body.Bytes())
+
+	// Rotated keys
+	require.NoError(handler.SetKeys([]PublishedKey{{KeyID: "next", Key: rsaKey}}, []PublishedKey{{KeyID: "current", Key: ecKey}}))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.NotEqual(etag, recorder.Header().Get("ETag"))
+
+	keys, _, err = fetchJWKS(http.DefaultClient, ts.URL, time.Hour)
+	require.NoError(err)
+	assert.Contains(keys, "next")
+	assert.NotContains(keys, "previous")
+
+	// Invalid keys
+	assert.Error(handler.SetKeys([]PublishedKey{{KeyID: "a", Key: ecKey}, {KeyID: "a", Key: rsaKey}}, nil))
+	assert.Error(handler.SetKeys([]PublishedKey{{KeyID: "a", Key: []byte("secret")}}, nil))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,192 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Serves a key set with the specified key IDs, which can be changed, and
+// counts the requests
+type testKeySet struct {
+	mu       sync.Mutex
+	kids     []string
+	status   int
+	header   http.Header
+	requests int32
+	key      *rsa.PublicKey
+}
+
+func (s *testKeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.requests, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	var set jose.JSONWebKeySet
+	for _, kid := range s.kids {
+		set.Keys = append(set.Keys, jose.JSONWebKey{Key: s.key, KeyID: kid, Use: "sig"})
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func (s *testKeySet) set(status int, kids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.kids = kids
+}
+
+func newTestKeySet(t *testing.T, kids ...string) (*testKeySet, *httptest.Server) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	set := &testKeySet{kids: kids, key: &key.PublicKey}
+	return set, httptest.NewServer(set)
+}
+
+func TestJWKSCacheRefetchOnMiss(t *testing.T) {
+	set, ts := newTestKeySet(t, "a")
+	defer ts.Close()
+
+	cache := NewJWKSCache(ts.URL)
+	cache.MinRefreshInterval = 100 * time.Millisecond
+	require.NoError(t, cache.Refresh())
+
+	_, ok := cache.Key("a")
+	assert.True(t, ok)
+
+	// Rotated keys are not picked up until MinRefreshInterval has elapsed
+	set.set(0, "b")
+	_, ok = cache.Key("b")
+	assert.False(t, ok)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&set.requests))
+
+	time.Sleep(150 * time.Millisecond)
+
+	// Concurrent lookups of unknown keys trigger a single fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Key("unknown")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&set.requests))
+
+	_, ok = cache.Key("b")
+	assert.True(t, ok)
+	_, ok = cache.Key("a")
+	assert.False(t, ok, "keys removed from the key set are no longer trusted")
+}
+
+func TestJWKSCacheFailureIsolation(t *testing.T) {
+	good, goodServer := newTestKeySet(t, "a")
+	defer goodServer.Close()
+	bad, badServer := newTestKeySet(t, "b")
+	defer badServer.Close()
+
+	bad.set(http.StatusInternalServerError)
+
+	cache := NewJWKSCache(goodServer.URL + " " + badServer.URL)
+	cache.MinRefreshInterval = time.Millisecond
+	require.NoError(t, cache.Refresh(), "one key set is enough")
+
+	_, ok := cache.Key("a")
+	assert.True(t, ok)
+
+	// A failing key set keeps its previous keys
+	bad.set(0, "b")
+	time.Sleep(2 * time.Millisecond)
+	_, ok = cache.Key("b")
+	assert.True(t, ok)
+	good.set(http.StatusBadGateway)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = cache.Key("unknown")
+	assert.False(t, ok)
+	_, ok = cache.Key("a")
+	assert.True(t, ok)
+
+	bad.set(http.StatusInternalServerError)
+	assert.Error(t, cache.Refresh())
+	assert.Len(t, cache.Keys(), 2)
+}
+
+func TestJWKSCacheBackgroundRefresh(t *testing.T) {
+	set, ts := newTestKeySet(t, "a")
+	defer ts.Close()
+	set.header = http.Header{"Cache-Control": {"public, max-age=0"}}
+
+	cache := NewJWKSCache(ts.URL)
+	cache.MinRefreshInterval = 20 * time.Millisecond
+	require.NoError(t, cache.Refresh())
+
+	cache.Start()
+	set.set(0, "b")
+	time.Sleep(100 * time.Millisecond)
+	cache.Stop()
+
+	assert.Contains(t, cache.Keys(), "b")
+
+	requests := atomic.LoadInt32(&set.requests)
+	assert.Greater(t, requests, int32(1))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, requests, atomic.LoadInt32(&set.requests), "no refresh once stopped")
+}
+
+func Test_maxAge(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{
+			name:   "No header",
+			header: http.Header{},
+			want:   time.Hour,
+		},
+		{
+			name:   "max-age",
+			header: http.Header{"Cache-Control": {"public, max-age=300, must-revalidate"}},
+			want:   5 * time.Minute,
+		},
+		{
+			name:   "no-cache",
+			header: http.Header{"Cache-Control": {"no-cache"}},
+			want:   0,
+		},
+		{
+			name:   "Expires in the past",
+			header: http.Header{"Expires": {"Thu, 01 Dec 1994 16:00:00 GMT"}},
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, maxAge(tt.header, time.Hour))
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -13,6 +15,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/9spokes/go/logging/v3"
 	"github.com/dgrijalva/jwt-go"
@@ -24,31 +27,64 @@ const (
 	X5C = "x5c"
 )
 
+// HTTP client used when none is provided, whose timeout prevents an
+// unresponsive server from blocking the requests forever
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// DefaultAlgorithms are the signing algorithms accepted when the context does
+// not specify any. HMAC and none are never accepted by default.
+var DefaultAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
 // Context holds the config required to parse and validate a token
 type Context struct {
-	JWKSURLs     string
-	TrustedKeys  map[string]rsa.PublicKey
+	// Expected issuer of ID tokens, set by NewFromDiscovery
+	Issuer   string
+	JWKSURLs string
+	// Keys retrieved from JWKSURLs, set by New
+	JWKS *JWKSCache
+	// Static public keys by key ID: RSA and ECDSA keys either as values or
+	// pointers, e.g. rsa.PublicKey or *rsa.PublicKey, or ed25519.PublicKey.
+	// Must not be modified once the context is in use.
+	TrustedKeys  map[string]crypto.PublicKey
 	TrustedCerts []x509.Certificate
 	PrivateKey   *rsa.PrivateKey
+	// Key decrypting the JWEs when it is not the PrivateKey, e.g. an
+	// *ecdsa.PrivateKey for tokens encrypted with ECDH-ES
+	DecryptionKey crypto.PrivateKey
+	// Validate the x5c certificate chain up to one of these roots, instead of
+	// only accepting the TrustedCerts
+	Roots *x509.CertPool
+	// Additional intermediate certificates used to build the x5c chain
+	Intermediates []*x509.Certificate
+	// Also require the x5c certificate to be one of the TrustedCerts when
+	// validating the chain
+	PinCertificates bool
+	// Optional revocation check of the x5c certificate chain
+	RevocationChecker RevocationChecker
+	// Accepted signing algorithms, DefaultAlgorithms if empty
+	Algorithms []string
 }
 
 // New creates a new JWT context
 func New(jwksURLs, trustStorePath, privateKeyPath, privateKeyPwd string) (*Context, error) {
 	ctx := Context{
 		JWKSURLs:     jwksURLs,
-		TrustedKeys:  make(map[string]rsa.PublicKey),
+		TrustedKeys:  make(map[string]crypto.PublicKey),
 		TrustedCerts: make([]x509.Certificate, 0),
 		PrivateKey:   nil,
 	}
 
 	if jwksURLs != "" {
 
-		keys, err := fetchJWKS(jwksURLs)
-		if err != nil {
+		ctx.JWKS = NewJWKSCache(jwksURLs)
+		if err := ctx.JWKS.Refresh(); err != nil {
 			return nil, fmt.Errorf("while retrieving web keys: %s", err.Error())
 		}
-
-		ctx.TrustedKeys = keys
 	}
 
 	if trustStorePath != "" {
@@ -74,6 +110,7 @@ func New(jwksURLs, trustStorePath, privateKeyPath, privateKeyPwd string) (*Conte
 // Validate checks the signature, decrypts if necessary and verifies the
 // standard claims to ensure that a token is valid. Retruns the token claims if
 // everythign is ok.
+// Use ValidateWithOptions to also check the issuer, audience or token age.
 func (ctx *Context) Validate(input string) (map[string]interface{}, error) {
 	// JWE's are made up of 5 parts (see https://www.rfc-editor.org/info/rfc7516)
 	// JWS's are made up of 3 parts (see https://www.rfc-editor.org/info/rfc7515)
@@ -103,11 +140,15 @@ func (ctx *Context) decrypt(tokenString string) (string, error) {
 		return "", fmt.Errorf("failed to parse token: %s", err.Error())
 	}
 
-	if ctx.PrivateKey == nil {
-		return "", fmt.Errorf("missing private key")
+	key := ctx.DecryptionKey
+	if key == nil {
+		if ctx.PrivateKey == nil {
+			return "", fmt.Errorf("missing private key")
+		}
+		key = ctx.PrivateKey
 	}
 
-	payload, err := token.Decrypt(ctx.PrivateKey)
+	payload, err := token.Decrypt(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt token: %s", err.Error())
 	}
@@ -118,7 +159,11 @@ func (ctx *Context) decrypt(tokenString string) (string, error) {
 // Identifies and returns the token signing key
 func (ctx *Context) getSigningKey(token *jwt.Token) (interface{}, error) {
 	// Don't forget to validate the alg is what you expect:
-	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+	algorithms := ctx.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = DefaultAlgorithms
+	}
+	if !contains(algorithms, token.Method.Alg()) {
 		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
 
@@ -128,71 +173,68 @@ func (ctx *Context) getSigningKey(token *jwt.Token) (interface{}, error) {
 		return nil, fmt.Errorf("unrecognised public key type '%s': %s", keyType, err.Error())
 	}
 
+	var publicKey crypto.PublicKey
+
 	switch keyType {
 	case KID:
-		kid := token.Header[KID].(string)
-		publicKey, ok := ctx.TrustedKeys[kid]
-		// If key is missing, refresh the keyMap just in case the keys were
-		// rotated since we last read them
-		if !ok {
-			keys, err := fetchJWKS(ctx.JWKSURLs)
-			if err != nil {
-				return nil, fmt.Errorf("while retrieving web keys: %s", err.Error())
-			}
-
-			ctx.TrustedKeys = keys
-			publicKey, ok = ctx.TrustedKeys[kid]
+		kid, _ := token.Header[KID].(string)
+		var ok bool
+		publicKey, ok = ctx.TrustedKeys[kid]
+		// The key sets are refreshed if the key is missing, in case the keys
+		// were rotated since we last read them
+		if !ok && ctx.JWKS != nil {
+			publicKey, ok = ctx.JWKS.Key(kid)
 		}
 
 		if !ok {
 			return nil, fmt.Errorf("no key found for id [%s]", kid)
 		}
 
-		return &publicKey, nil
-
 	case X5C:
-		var certificate string
-
-		if x5c, ok := token.Header[X5C].([]interface{}); ok {
-			certificate = x5c[0].(string)
-		} else if x5c, ok := token.Header[X5C].(string); ok {
-			certificate = x5c
-		} else {
-			return nil, fmt.Errorf("invalid x5c header, not string and not array of strings")
+		cert, err := ctx.verifyX5C(token.Header[X5C])
+		if err != nil {
+			return nil, err
 		}
 
-		// Our decoded DER certificate
-		var der []byte
+		publicKey = cert.PublicKey
+	}
 
-		// Assume a certificate chain is provided with proper BEGIN and END lines
-		block, _ := pem.Decode([]byte(certificate))
-		if block == nil {
-			// If the Decoding fails, assume it is a single Base64-encoded DER certificate
-			der, err = base64.StdEncoding.DecodeString(certificate)
-			// If the decoding fails, we're unable to handle the data
-			if err != nil {
-				return nil, fmt.Errorf("could not decode x509 certificate: %s", certificate)
-			}
-		} else {
-			der = block.Bytes
-		}
+	publicKey = keyPointer(publicKey)
 
-		var cert *x509.Certificate
-		cert, err := x509.ParseCertificate(der)
-		if err != nil {
-			return nil, fmt.Errorf("could not load x5c certificate")
-		}
-
-		if !isJWSAuthorized(cert, ctx.TrustedCerts) {
-			return nil, fmt.Errorf("certificate is not trusted")
-		}
+	if !keyMatches(token.Method, publicKey) {
+		return nil, fmt.Errorf("%T key cannot be used with signing method %s", publicKey, token.Method.Alg())
+	}
 
-		publicKey := cert.PublicKey.(*rsa.PublicKey)
+	return publicKey, nil
+}
 
-		return publicKey, nil
+// Returns RSA and ECDSA keys stored as values as pointers, the type expected
+// by jwt-go
+func keyPointer(key crypto.PublicKey) crypto.PublicKey {
+	switch k := key.(type) {
+	case rsa.PublicKey:
+		return &k
+	case ecdsa.PublicKey:
+		return &k
 	}
+	return key
+}
 
-	return nil, nil
+// Checks that the type of the key, and its curve for ECDSA, is the one
+// expected by the signing method
+func keyMatches(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		k, ok := key.(*ecdsa.PublicKey)
+		return ok && k.Curve.Params().BitSize == m.CurveBits
+	case *SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	}
+	return false
 }
 
 // Checks whether this certificate (identified by thumbprint) is part of the trust keystore
@@ -235,32 +277,43 @@ func getKeyType(joseHeader map[string]interface{}) (string, error) {
 	return keyType, nil
 }
 
-// fetchJWKS retrieves a JSON Web Key Set
-func fetchJWKS(jwksURLs string) (map[string]rsa.PublicKey, error) {
-	keys := make(map[string]rsa.PublicKey)
+// fetchJWKS retrieves a JSON Web Key Set, returning its keys and how long it
+// can be cached for
+func fetchJWKS(client *http.Client, jwksURL string, defaultMaxAge time.Duration) (map[string]crypto.PublicKey, time.Duration, error) {
+	keys := make(map[string]crypto.PublicKey)
 
-	for _, jwksURL := range strings.Split(jwksURLs, " ") {
+	response, err := client.Get(jwksURL)
+	if err != nil {
+		return keys, 0, fmt.Errorf("while connecting to remote endpoint '%s': %s", jwksURL, err.Error())
+	}
+	defer response.Body.Close()
 
-		// Get open id connect configuration
-		response, err := http.Get(jwksURL)
-		if err != nil {
-			return keys, fmt.Errorf("while connecting to remote endpoint '%s': %s", jwksURL, err.Error())
-		}
-		data, _ := ioutil.ReadAll(response.Body)
+	data, _ := ioutil.ReadAll(response.Body)
 
-		var set jose.JSONWebKeySet
-		if err := json.Unmarshal(data, &set); err != nil {
-			logging.Debugf("failed unmarshalling body: %s", data)
-			return keys, fmt.Errorf("unmarshalling response from '%s': %w", jwksURL, err)
-		}
+	if response.StatusCode != http.StatusOK {
+		return keys, 0, fmt.Errorf("non-OK response from '%s': [HTTP %d] %s", jwksURL, response.StatusCode, data)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		logging.Debugf("failed unmarshalling body: %s", data)
+		return keys, 0, fmt.Errorf("unmarshalling response from '%s': %w", jwksURL, err)
+	}
 
-		// Copy key to key map
-		for _, key := range set.Keys {
-			keys[key.KeyID] = *(key.Key.(*rsa.PublicKey))
+	// Copy key to key map, skipping encryption and symmetric keys
+	for _, key := range set.Keys {
+		if key.Use == "enc" {
+			continue
+		}
+		switch key.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+			keys[key.KeyID] = key.Key
+		default:
+			logging.Warningf("skipping unsupported key '%s' of type %T from '%s'", key.KeyID, key.Key, jwksURL)
 		}
 	}
 
-	return keys, nil
+	return keys, maxAge(response.Header, defaultMaxAge), nil
 }
 
 // loadCerts loads certificates in the trust store
@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -415,7 +416,7 @@ func Test_fetchJWKS(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := fetchJWKS(tt.jwksURL)
+			got, _, err := fetchJWKS(http.DefaultClient, tt.jwksURL, time.Hour)
 			if err != nil && tt.err {
 				return
 			}
@@ -0,0 +1,202 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Path of the discovery document relative to the issuer (see
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig)
+const wellKnownPath = "/.well-known/openid-configuration"
+
+// OIDCConfiguration holds the OpenID Provider metadata used to validate ID
+// tokens.
+type OIDCConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// FetchOIDCConfiguration retrieves the OpenID Provider metadata. The issuer is
+// either the issuer identifier, in which case the well-known path is appended
+// and the issuer advertised by the provider must match, or the full URL of the
+// discovery document.
+func FetchOIDCConfiguration(issuer string) (*OIDCConfiguration, error) {
+	return FetchOIDCConfigurationWithClient(nil, issuer)
+}
+
+// FetchOIDCConfigurationWithClient is FetchOIDCConfiguration using the HTTP
+// client. A client with a 10 seconds timeout is used if it is nil.
+func FetchOIDCConfigurationWithClient(client *http.Client, issuer string) (*OIDCConfiguration, error) {
+
+	if client == nil {
+		client = defaultClient
+	}
+
+	discoveryURL := issuer
+	if !strings.Contains(issuer, "/.well-known/") {
+		discoveryURL = strings.TrimSuffix(issuer, "/") + wellKnownPath
+	} else {
+		issuer = ""
+	}
+
+	response, err := client.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("while connecting to discovery endpoint '%s': %s", discoveryURL, err.Error())
+	}
+	defer response.Body.Close()
+
+	data, _ := ioutil.ReadAll(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-OK response from discovery endpoint '%s': [HTTP %d] %s", discoveryURL, response.StatusCode, data)
+	}
+
+	var config OIDCConfiguration
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("while unmarshaling OIDC configuration: %s", err.Error())
+	}
+
+	if issuer != "" && strings.TrimSuffix(config.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("issuer mismatch: expecting '%s', discovery document has '%s'", issuer, config.Issuer)
+	}
+
+	if config.JWKSURI == "" {
+		return nil, fmt.Errorf("no jwks_uri in OIDC configuration from '%s'", discoveryURL)
+	}
+
+	return &config, nil
+}
+
+// NewFromDiscovery creates a new JWT context trusting the keys of an OpenID
+// Provider, found through its discovery document. The issuer of the context is
+// set to the one advertised by the provider.
+func NewFromDiscovery(issuer, trustStorePath, privateKeyPath, privateKeyPwd string) (*Context, error) {
+
+	config, err := FetchOIDCConfiguration(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("while retrieving OIDC configuration: %s", err.Error())
+	}
+
+	ctx, err := New(config.JWKSURI, trustStorePath, privateKeyPath, privateKeyPwd)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Issuer = config.Issuer
+
+	return ctx, nil
+}
+
+// IDTokenOptions holds the expected values of an ID token's claims.
+type IDTokenOptions struct {
+	// Expected issuer, the context's issuer is used if not set
+	Issuer string
+	// The client_id of the relying party, which must be one of the audiences
+	ClientID string
+	// The nonce sent in the authentication request, not checked if empty
+	Nonce string
+	// The access token issued along with the ID token, checked against the
+	// at_hash claim when both are present
+	AccessToken string
+	// The authorization code issued along with the ID token, checked against
+	// the c_hash claim when both are present
+	Code string
+	// Tolerated clock skew when checking exp and iat
+	Leeway time.Duration
+}
+
+// ValidateIDToken checks the signature and the claims of an OpenID Connect ID
+// token as described in
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation.
+// Returns the token claims if everything is ok, or a ClaimError describing the
+// first failed check.
+func (ctx *Context) ValidateIDToken(input string, opts IDTokenOptions) (map[string]interface{}, error) {
+
+	if opts.Issuer == "" {
+		opts.Issuer = ctx.Issuer
+	}
+	if opts.Issuer == "" {
+		return nil, fmt.Errorf("no issuer to validate the ID token against")
+	}
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("no client_id to validate the ID token against")
+	}
+
+	token, err := ctx.validate(input, ValidateOptions{
+		Issuers:        []string{opts.Issuer},
+		Audiences:      []string{opts.ClientID},
+		RequiredClaims: []string{"iss", "sub", "aud", "exp", "iat"},
+		Leeway:         opts.Leeway,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	azp, hasAzp := claims["azp"].(string)
+	if len(audience(claims)) > 1 && !hasAzp {
+		return nil, &ClaimError{Claim: "azp", Err: ErrMissingClaim}
+	}
+	if hasAzp && azp != opts.ClientID {
+		return nil, &ClaimError{Claim: "azp", Err: ErrInvalidClaim}
+	}
+
+	if opts.Nonce != "" {
+		if nonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(opts.Nonce)) != 1 {
+			return nil, &ClaimError{Claim: "nonce", Err: ErrInvalidClaim}
+		}
+	}
+
+	if atHash, ok := claims["at_hash"].(string); ok && opts.AccessToken != "" {
+		if !verifyHash(token.Method.Alg(), opts.AccessToken, atHash) {
+			return nil, &ClaimError{Claim: "at_hash", Err: ErrInvalidClaim}
+		}
+	}
+
+	if cHash, ok := claims["c_hash"].(string); ok && opts.Code != "" {
+		if !verifyHash(token.Method.Alg(), opts.Code, cHash) {
+			return nil, &ClaimError{Claim: "c_hash", Err: ErrInvalidClaim}
+		}
+	}
+
+	return claims, nil
+}
+
+// Checks an at_hash or c_hash claim: the base64url encoding of the left-most
+// half of the hash of the value, using the hash algorithm of the token's alg.
+func verifyHash(alg, value, expected string) bool {
+
+	var hash crypto.Hash
+	switch {
+	case alg == "EdDSA":
+		// Ed25519 is the only curve supported
+		hash = crypto.SHA512
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "512"):
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+
+	h := hash.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]) == expected
+}
@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Starts an OpenID Provider serving its discovery document and key set,
+// returns the provider and a function signing tokens with its key.
+func newTestProvider(t *testing.T) (*httptest.Server, func(jwt.MapClaims) string) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var ts *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc(wellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCConfiguration{Issuer: ts.URL, JWKSURI: ts.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	ts = httptest.NewServer(mux)
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header[KID] = "test"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	return ts, sign
+}
+
+func TestFetchOIDCConfiguration(t *testing.T) {
+	ts, _ := newTestProvider(t)
+	defer ts.Close()
+
+	config, err := FetchOIDCConfiguration(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/keys", config.JWKSURI)
+
+	config, err = FetchOIDCConfiguration(ts.URL + wellKnownPath)
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL, config.Issuer)
+
+	_, err = FetchOIDCConfiguration(ts.URL + "/other")
+	assert.Error(t, err)
+}
+
+func TestFetchOIDCConfigurationWithClient(t *testing.T) {
+	ts, _ := newTestProvider(t)
+	defer ts.Close()
+
+	config, err := FetchOIDCConfigurationWithClient(ts.Client(), ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/keys", config.JWKSURI)
+
+	unresponsive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer unresponsive.Close()
+
+	_, err = FetchOIDCConfigurationWithClient(&http.Client{Timeout: 50 * time.Millisecond}, unresponsive.URL)
+	assert.Error(t, err)
+}
+
+func TestValidateIDToken(t *testing.T) {
+	ts, sign := newTestProvider(t)
+	defer ts.Close()
+
+	ctx, err := NewFromDiscovery(ts.URL, "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL, ctx.Issuer)
+
+	sum := sha256.Sum256([]byte("access-token"))
+	atHash := base64.RawURLEncoding.EncodeToString(sum[:16])
+
+	now := time.Now().Unix()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":     ts.URL,
+			"sub":     "123",
+			"aud":     "client",
+			"exp":     now + 60,
+			"iat":     now,
+			"nonce":   "nonce",
+			"at_hash": atHash,
+		}
+	}
+	opts := IDTokenOptions{ClientID: "client", Nonce: "nonce", AccessToken: "access-token"}
+
+	tests := []struct {
+		name   string
+		update func(jwt.MapClaims)
+		opts   func(*IDTokenOptions)
+		err    error
+	}{
+		{
+			name: "Valid token",
+		},
+		{
+			name:   "Multiple audiences with azp",
+			update: func(c jwt.MapClaims) { c["aud"] = []string{"client", "other"}; c["azp"] = "client" },
+		},
+		{
+			name:   "Multiple audiences without azp",
+			update: func(c jwt.MapClaims) { c["aud"] = []string{"client", "other"} },
+			err:    ErrMissingClaim,
+		},
+		{
+			name:   "Wrong azp",
+			update: func(c jwt.MapClaims) { c["azp"] = "other" },
+			err:    ErrInvalidClaim,
+		},
+		{
+			name:   "Wrong issuer",
+			update: func(c jwt.MapClaims) { c["iss"] = "https://example.com" },
+			err:    ErrInvalidIssuer,
+		},
+		{
+			name:   "Wrong audience",
+			update: func(c jwt.MapClaims) { c["aud"] = "other" },
+			err:    ErrInvalidAudience,
+		},
+		{
+			name:   "Expired",
+			update: func(c jwt.MapClaims) { c["exp"] = now - 30 },
+			err:    ErrExpired,
+		},
+		{
+			name:   "Expired within leeway",
+			update: func(c jwt.MapClaims) { c["exp"] = now - 30 },
+			opts:   func(o *IDTokenOptions) { o.Leeway = time.Minute },
+		},
+		{
+			name:   "Issued in the future",
+			update: func(c jwt.MapClaims) { c["iat"] = now + 30 },
+			err:    ErrIssuedInFuture,
+		},
+		{
+			name:   "Wrong nonce",
+			update: func(c jwt.MapClaims) { c["nonce"] = "other" },
+			err:    ErrInvalidClaim,
+		},
+		{
+			name: "Wrong access token",
+			opts: func(o *IDTokenOptions) { o.AccessToken = "other" },
+			err:  ErrInvalidClaim,
+		},
+		{
+			name:   "Wrong code",
+			update: func(c jwt.MapClaims) { c["c_hash"] = atHash },
+			opts:   func(o *IDTokenOptions) { o.Code = "code" },
+			err:    ErrInvalidClaim,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			if tt.update != nil {
+				tt.update(claims)
+			}
+			o := opts
+			if tt.opts != nil {
+				tt.opts(&o)
+			}
+
+			got, err := ctx.ValidateIDToken(sign(claims), o)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "123", got["sub"])
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// SignOptions holds the parameters used to sign a token.
+type SignOptions struct {
+	// Signing key, the context's PrivateKey if not set. Any crypto.Signer can
+	// be used, e.g. the http/v2 KeyVault HSM key.
+	Signer crypto.Signer
+	// Signing algorithm, derived from the type of the key if not set: RS256,
+	// ES256, ES384, ES512 or EdDSA
+	Algorithm string
+	// Set as the kid header if not empty
+	KeyID string
+	// Certificate chain set as the x5c header, starting with the certificate
+	// of the signing key
+	Certificates []*x509.Certificate
+	// Additional header parameters
+	Headers map[string]interface{}
+}
+
+// EncryptOptions holds the parameters used to sign and encrypt a token.
+type EncryptOptions struct {
+	SignOptions
+	// Key management algorithm, RSA-OAEP-256 for RSA keys and ECDH-ES+A256KW
+	// for EC keys if not set
+	KeyAlgorithm string
+	// Content encryption algorithm, A256GCM if not set
+	ContentEncryption string
+	// Key ID of the recipient's key, set as the kid header of the JWE if not
+	// empty
+	RecipientKeyID string
+}
+
+// Sign returns the claims as a signed JWT (JWS compact serialization).
+func (ctx *Context) Sign(claims map[string]interface{}, opts SignOptions) (string, error) {
+
+	signer := opts.Signer
+	if signer == nil {
+		if ctx.PrivateKey == nil {
+			return "", fmt.Errorf("missing private key")
+		}
+		signer = ctx.PrivateKey
+	}
+
+	publicKey := signer.Public()
+	if publicKey == nil {
+		return "", fmt.Errorf("unable to retrieve public key")
+	}
+
+	alg := opts.Algorithm
+	if alg == "" {
+		alg = defaultAlgorithm(publicKey)
+	}
+
+	method := jwt.GetSigningMethod(alg)
+	if method == nil || !keyMatches(method, publicKey) {
+		return "", fmt.Errorf("%T key cannot be used with signing method '%s'", publicKey, alg)
+	}
+
+	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
+	for k, v := range opts.Headers {
+		token.Header[k] = v
+	}
+	if opts.KeyID != "" {
+		token.Header[KID] = opts.KeyID
+	}
+	if len(opts.Certificates) > 0 {
+		x5c := make([]string, len(opts.Certificates))
+		for i, cert := range opts.Certificates {
+			x5c[i] = base64.StdEncoding.EncodeToString(cert.Raw)
+		}
+		token.Header[X5C] = x5c
+	}
+
+	signingString, err := token.SigningString()
+	if err != nil {
+		return "", fmt.Errorf("while encoding token: %s", err.Error())
+	}
+
+	signature, err := sign(signer, method, []byte(signingString))
+	if err != nil {
+		return "", fmt.Errorf("while signing token: %s", err.Error())
+	}
+
+	return signingString + "." + jwt.EncodeSegment(signature), nil
+}
+
+// Encrypt signs the claims and encrypts the resulting JWT for the recipient's
+// public key, returning a nested JWT (JWE compact serialization) which can be
+// read by Validate with the recipient's private key: the PrivateKey of its
+// context for RSA keys, or its DecryptionKey for EC keys.
+func (ctx *Context) Encrypt(claims map[string]interface{}, recipientKey crypto.PublicKey, opts EncryptOptions) (string, error) {
+
+	jws, err := ctx.Sign(claims, opts.SignOptions)
+	if err != nil {
+		return "", err
+	}
+
+	keyAlgorithm := jose.KeyAlgorithm(opts.KeyAlgorithm)
+	if keyAlgorithm == "" {
+		switch recipientKey.(type) {
+		case *rsa.PublicKey:
+			keyAlgorithm = jose.RSA_OAEP_256
+		case *ecdsa.PublicKey:
+			keyAlgorithm = jose.ECDH_ES_A256KW
+		default:
+			return "", fmt.Errorf("unsupported recipient key type %T", recipientKey)
+		}
+	}
+
+	contentEncryption := jose.ContentEncryption(opts.ContentEncryption)
+	if contentEncryption == "" {
+		contentEncryption = jose.A256GCM
+	}
+
+	encrypter, err := jose.NewEncrypter(
+		contentEncryption,
+		jose.Recipient{Algorithm: keyAlgorithm, Key: recipientKey, KeyID: opts.RecipientKeyID},
+		(&jose.EncrypterOptions{}).WithContentType("JWT").WithType("JWT"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("while creating encrypter: %s", err.Error())
+	}
+
+	object, err := encrypter.Encrypt([]byte(jws))
+	if err != nil {
+		return "", fmt.Errorf("while encrypting token: %s", err.Error())
+	}
+
+	return object.CompactSerialize()
+}
+
+// Returns the signing algorithm used with a key when none is specified
+func defaultAlgorithm(key crypto.PublicKey) string {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return "ES384"
+		case elliptic.P521():
+			return "ES512"
+		}
+		return "ES256"
+	case ed25519.PublicKey:
+		return "EdDSA"
+	}
+	return "RS256"
+}
+
+// Signs the message with a crypto.Signer, returning the signature in the
+// format expected in a JWS
+func sign(signer crypto.Signer, method jwt.SigningMethod, message []byte) ([]byte, error) {
+
+	var hash crypto.Hash
+	var opts crypto.SignerOpts
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSAPSS:
+		hash = m.Hash
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	case *jwt.SigningMethodRSA:
+		hash = m.Hash
+		opts = hash
+	case *jwt.SigningMethodECDSA:
+		hash = m.Hash
+		opts = hash
+	case *SigningMethodEd25519:
+		// Ed25519 signs the message itself
+		return signer.Sign(rand.Reader, message, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("unsupported signing method '%s'", method.Alg())
+	}
+
+	h := hash.New()
+	h.Write(message)
+
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := method.(*jwt.SigningMethodECDSA); ok {
+		// crypto.Signer returns ASN.1 encoded ECDSA signatures while JWS
+		// uses the concatenation of R and S (RFC 7518 section 3.4)
+		var parsed struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(signature, &parsed); err != nil {
+			return nil, fmt.Errorf("while decoding ECDSA signature: %s", err.Error())
+		}
+
+		size := (m.CurveBits + 7) / 8
+		signature = make([]byte, 2*size)
+		parsed.R.FillBytes(signature[:size])
+		parsed.S.FillBytes(signature[size:])
+	}
+
+	return signature, nil
+}
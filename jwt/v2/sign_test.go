@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p521Key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &p256Key.PublicKey, p256Key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ctx := &Context{
+		PrivateKey: rsaKey,
+		TrustedKeys: map[string]crypto.PublicKey{
+			"rsa":     &rsaKey.PublicKey,
+			"p256":    &p256Key.PublicKey,
+			"p521":    &p521Key.PublicKey,
+			"ed25519": edKey.Public(),
+			// Stored as values, as when the map only held RSA keys
+			"rsa-value":  rsaKey.PublicKey,
+			"p256-value": p256Key.PublicKey,
+		},
+		TrustedCerts: []x509.Certificate{*cert},
+	}
+
+	claims := map[string]interface{}{"sub": "123", "exp": time.Now().Add(time.Minute).Unix()}
+
+	tests := []struct {
+		name string
+		opts SignOptions
+		alg  string
+		err  bool
+	}{
+		{
+			name: "Context private key",
+			opts: SignOptions{KeyID: "rsa"},
+			alg:  "RS256",
+		},
+		{
+			name: "RSA-PSS",
+			opts: SignOptions{KeyID: "rsa", Algorithm: "PS384"},
+			alg:  "PS384",
+		},
+		{
+			name: "ECDSA signer",
+			opts: SignOptions{KeyID: "p256", Signer: p256Key},
+			alg:  "ES256",
+		},
+		{
+			name: "ECDSA P-521 signer",
+			opts: SignOptions{KeyID: "p521", Signer: p521Key},
+			alg:  "ES512",
+		},
+		{
+			name: "Ed25519 signer",
+			opts: SignOptions{KeyID: "ed25519", Signer: edKey},
+			alg:  "EdDSA",
+		},
+		{
+			name: "RSA key stored as a value",
+			opts: SignOptions{KeyID: "rsa-value"},
+			alg:  "RS256",
+		},
+		{
+			name: "ECDSA key stored as a value",
+			opts: SignOptions{KeyID: "p256-value", Signer: p256Key},
+			alg:  "ES256",
+		},
+		{
+			name: "Certificate chain",
+			opts: SignOptions{Signer: p256Key, Certificates: []*x509.Certificate{cert}},
+			alg:  "ES256",
+		},
+		{
+			name: "Algorithm not matching the key",
+			opts: SignOptions{Signer: p256Key, Algorithm: "RS256"},
+			err:  true,
+		},
+		{
+			name: "HMAC",
+			opts: SignOptions{Algorithm: "HS256"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ctx.Sign(claims, tt.opts)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			got, err := ctx.Validate(token)
+			require.NoError(t, err)
+			assert.Equal(t, "123", got["sub"])
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Header["alg"])
+		})
+	}
+
+	_, err = (&Context{}).Sign(claims, SignOptions{})
+	assert.Error(t, err, "no signing key")
+}
+
+func TestEncrypt(t *testing.T) {
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	recipientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &Context{PrivateKey: signingKey}
+	recipient := &Context{
+		PrivateKey:  recipientKey,
+		TrustedKeys: map[string]crypto.PublicKey{"issuer": &signingKey.PublicKey},
+	}
+
+	token, err := issuer.Encrypt(
+		map[string]interface{}{"sub": "123", "exp": time.Now().Add(time.Minute).Unix()},
+		&recipientKey.PublicKey,
+		EncryptOptions{SignOptions: SignOptions{KeyID: "issuer"}, RecipientKeyID: "recipient"},
+	)
+	require.NoError(t, err)
+
+	got, err := recipient.Validate(token)
+	require.NoError(t, err)
+	assert.Equal(t, "123", got["sub"])
+
+	_, err = issuer.Validate(token)
+	assert.Error(t, err, "only the recipient can decrypt the token")
+}
+
+func TestEncryptEC(t *testing.T) {
+
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	recipientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issuer := &Context{}
+	recipient := &Context{
+		DecryptionKey: recipientKey,
+		TrustedKeys:   map[string]crypto.PublicKey{"issuer": &signingKey.PublicKey},
+	}
+
+	token, err := issuer.Encrypt(
+		map[string]interface{}{"sub": "123", "exp": time.Now().Add(time.Minute).Unix()},
+		&recipientKey.PublicKey,
+		EncryptOptions{SignOptions: SignOptions{Signer: signingKey, KeyID: "issuer"}},
+	)
+	require.NoError(t, err)
+
+	got, err := recipient.Validate(token)
+	require.NoError(t, err)
+	assert.Equal(t, "123", got["sub"])
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	recipient.DecryptionKey = other
+	_, err = recipient.Validate(token)
+	assert.Error(t, err, "only the recipient can decrypt the token")
+}
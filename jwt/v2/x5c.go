@@ -0,0 +1,237 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Clock skew tolerated when checking the validity interval of OCSP responses
+const ocspClockSkew = 5 * time.Minute
+
+// ErrCertificateRevoked is returned by revocation checkers when a certificate
+// has been revoked.
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
+// RevocationChecker checks whether a certificate of an x5c chain has been
+// revoked, e.g. using CRLs or OCSP.
+type RevocationChecker interface {
+	// CheckRevocation returns an error if the certificate, issued by issuer,
+	// has been revoked or its status cannot be determined.
+	CheckRevocation(cert, issuer *x509.Certificate) error
+}
+
+// RevocationCheckerFunc is an adapter to use a function as a
+// RevocationChecker.
+type RevocationCheckerFunc func(cert, issuer *x509.Certificate) error
+
+// CheckRevocation calls f(cert, issuer).
+func (f RevocationCheckerFunc) CheckRevocation(cert, issuer *x509.Certificate) error {
+	return f(cert, issuer)
+}
+
+// OCSPChecker is a RevocationChecker querying the OCSP responder of the
+// certificates.
+type OCSPChecker struct {
+	// Optional HTTP client, a client with a 10 seconds timeout is used if not
+	// set
+	Client *http.Client
+	// Accept certificates whose status cannot be determined, because they
+	// have no OCSP responder or it cannot be reached
+	SoftFail bool
+}
+
+// CheckRevocation implements the RevocationChecker interface.
+func (c OCSPChecker) CheckRevocation(cert, issuer *x509.Certificate) error {
+
+	err := c.check(cert, issuer)
+	if err != nil && c.SoftFail && !errors.Is(err, ErrCertificateRevoked) {
+		return nil
+	}
+
+	return err
+}
+
+func (c OCSPChecker) check(cert, issuer *x509.Certificate) error {
+
+	if len(cert.OCSPServer) == 0 {
+		return fmt.Errorf("no OCSP responder for '%s'", cert.Subject)
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return fmt.Errorf("while creating OCSP request: %s", err.Error())
+	}
+
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	response, err := client.Post(cert.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return fmt.Errorf("while connecting to OCSP responder '%s': %s", cert.OCSPServer[0], err.Error())
+	}
+	defer response.Body.Close()
+
+	data, _ := ioutil.ReadAll(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-OK response from OCSP responder '%s': [HTTP %d]", cert.OCSPServer[0], response.StatusCode)
+	}
+
+	status, err := ocsp.ParseResponseForCert(data, cert, issuer)
+	if err != nil {
+		return fmt.Errorf("while parsing OCSP response: %s", err.Error())
+	}
+
+	// Responses outside of their validity interval may be replayed ones
+	now := time.Now()
+	if status.ThisUpdate.After(now.Add(ocspClockSkew)) {
+		return fmt.Errorf("OCSP response for '%s' is not valid yet", cert.Subject)
+	}
+	if !status.NextUpdate.IsZero() && now.After(status.NextUpdate.Add(ocspClockSkew)) {
+		return fmt.Errorf("OCSP response for '%s' is stale", cert.Subject)
+	}
+
+	switch status.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return ErrCertificateRevoked
+	}
+
+	return fmt.Errorf("unknown OCSP status for '%s'", cert.Subject)
+}
+
+// Returns the certificate whose key signed the token after checking it is
+// trusted. The certificate chain is validated when the context has Roots,
+// otherwise the certificate must be one of the TrustedCerts.
+func (ctx *Context) verifyX5C(header interface{}) (*x509.Certificate, error) {
+
+	var encoded []string
+
+	if x5c, ok := header.([]interface{}); ok && len(x5c) > 0 {
+		for _, c := range x5c {
+			s, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid x5c header, not string and not array of strings")
+			}
+			encoded = append(encoded, s)
+		}
+	} else if x5c, ok := header.(string); ok {
+		encoded = []string{x5c}
+	} else {
+		return nil, fmt.Errorf("invalid x5c header, not string and not array of strings")
+	}
+
+	leaf, err := parseCertificate(encoded[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Roots == nil {
+		if !isJWSAuthorized(leaf, ctx.TrustedCerts) {
+			return nil, fmt.Errorf("certificate is not trusted")
+		}
+		return leaf, nil
+	}
+
+	chain := []*x509.Certificate{leaf}
+	for _, certificate := range encoded[1:] {
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+
+	if err := ctx.verifyChain(chain); err != nil {
+		return nil, fmt.Errorf("certificate is not trusted: %w", err)
+	}
+
+	if ctx.PinCertificates && !isJWSAuthorized(leaf, ctx.TrustedCerts) {
+		return nil, fmt.Errorf("certificate is not trusted: not pinned")
+	}
+
+	return leaf, nil
+}
+
+// Verifies the chain up to one of the roots, the expiry and key usage of the
+// certificates, and their revocation status if there is a revocation checker
+func (ctx *Context) verifyChain(chain []*x509.Certificate) error {
+
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	for _, cert := range ctx.Intermediates {
+		intermediates.AddCert(cert)
+	}
+
+	verified, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         ctx.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return err
+	}
+
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("certificate cannot be used for digital signatures")
+	}
+
+	if ctx.RevocationChecker == nil {
+		return nil
+	}
+
+	// The root is trusted as is
+	path := verified[0]
+	for i := 0; i < len(path)-1; i++ {
+		if err := ctx.RevocationChecker.CheckRevocation(path[i], path[i+1]); err != nil {
+			return fmt.Errorf("while checking revocation of '%s': %w", path[i].Subject, err)
+		}
+	}
+
+	return nil
+}
+
+// Decodes a certificate of the x5c header
+func parseCertificate(certificate string) (*x509.Certificate, error) {
+
+	// Our decoded DER certificate
+	var der []byte
+
+	// Assume a certificate chain is provided with proper BEGIN and END lines
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		// If the Decoding fails, assume it is a single Base64-encoded DER certificate
+		var err error
+		der, err = base64.StdEncoding.DecodeString(certificate)
+		// If the decoding fails, we're unable to handle the data
+		if err != nil {
+			return nil, fmt.Errorf("could not decode x509 certificate: %s", certificate)
+		}
+	} else {
+		der = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("could not load x5c certificate")
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,277 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64
+
+// Creates a certificate from the template, signed by the parent or self-signed
+// if the parent is nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(atomic.AddInt64(&serial, 1))
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCertificate{cert: cert, key: key}
+}
+
+func newTestCA(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, parent)
+}
+
+func TestX5CChain(t *testing.T) {
+
+	root := newTestCA(t, "root", nil)
+	intermediate := newTestCA(t, "intermediate", root)
+	other := newTestCA(t, "other root", nil)
+
+	// OCSP responder reporting the leaf certificates with a serial number
+	// in revoked as revoked
+	revoked := map[int64]bool{}
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+
+		status := ocsp.Good
+		if revoked[request.SerialNumber.Int64()] {
+			status = ocsp.Revoked
+		}
+
+		response, err := ocsp.CreateResponse(intermediate.cert, intermediate.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, intermediate.key)
+		require.NoError(t, err)
+		w.Write(response)
+	}))
+	defer responder.Close()
+
+	leaf := func(template x509.Certificate) *testCertificate {
+		if template.KeyUsage == 0 {
+			template.KeyUsage = x509.KeyUsageDigitalSignature
+		}
+		template.Subject = pkix.Name{CommonName: "signer"}
+		template.OCSPServer = []string{responder.URL}
+		return newTestCertificate(t, &template, intermediate)
+	}
+
+	valid := leaf(x509.Certificate{})
+	expired := leaf(x509.Certificate{NotBefore: time.Now().Add(-2 * time.Hour), NotAfter: time.Now().Add(-time.Hour)})
+	encipherment := leaf(x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment})
+	revokedLeaf := leaf(x509.Certificate{})
+	revoked[revokedLeaf.cert.SerialNumber.Int64()] = true
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.cert)
+
+	checker := OCSPChecker{SoftFail: true}
+
+	tests := []struct {
+		name   string
+		ctx    *Context
+		signer *testCertificate
+		chain  []*x509.Certificate
+		err    string
+	}{
+		{
+			name:   "Valid chain",
+			ctx:    &Context{Roots: roots, RevocationChecker: checker},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert, intermediate.cert},
+		},
+		{
+			name:   "Intermediate from the context",
+			ctx:    &Context{Roots: roots, Intermediates: []*x509.Certificate{intermediate.cert}},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert},
+		},
+		{
+			name:   "Missing intermediate",
+			ctx:    &Context{Roots: roots},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert},
+			err:    "certificate is not trusted",
+		},
+		{
+			name:   "Unknown root",
+			ctx:    &Context{Roots: otherRoots},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert, intermediate.cert},
+			err:    "certificate is not trusted",
+		},
+		{
+			name:   "Expired certificate",
+			ctx:    &Context{Roots: roots},
+			signer: expired,
+			chain:  []*x509.Certificate{expired.cert, intermediate.cert},
+			err:    "expired",
+		},
+		{
+			name:   "Certificate not for signatures",
+			ctx:    &Context{Roots: roots},
+			signer: encipherment,
+			chain:  []*x509.Certificate{encipherment.cert, intermediate.cert},
+			err:    "cannot be used for digital signatures",
+		},
+		{
+			name:   "Revoked certificate",
+			ctx:    &Context{Roots: roots, RevocationChecker: checker},
+			signer: revokedLeaf,
+			chain:  []*x509.Certificate{revokedLeaf.cert, intermediate.cert},
+			err:    "revoked",
+		},
+		{
+			name: "Revocation checker failing",
+			ctx: &Context{Roots: roots, RevocationChecker: RevocationCheckerFunc(func(cert, issuer *x509.Certificate) error {
+				return errors.New("CRL unavailable")
+			})},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert, intermediate.cert},
+			err:    "CRL unavailable",
+		},
+		{
+			name:   "Pinned certificate",
+			ctx:    &Context{Roots: roots, PinCertificates: true, TrustedCerts: []x509.Certificate{*valid.cert}},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert, intermediate.cert},
+		},
+		{
+			name:   "Certificate not pinned",
+			ctx:    &Context{Roots: roots, PinCertificates: true, TrustedCerts: []x509.Certificate{*expired.cert}},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert, intermediate.cert},
+			err:    "not pinned",
+		},
+		{
+			name:   "Thumbprint only without roots",
+			ctx:    &Context{TrustedCerts: []x509.Certificate{*valid.cert}},
+			signer: valid,
+			chain:  []*x509.Certificate{valid.cert},
+		},
+	}
+
+	claims := map[string]interface{}{"sub": "123", "exp": time.Now().Add(time.Minute).Unix()}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.ctx.Sign(claims, SignOptions{Signer: tt.signer.key, Certificates: tt.chain})
+			require.NoError(t, err)
+
+			got, err := tt.ctx.Validate(token)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "123", got["sub"])
+		})
+	}
+}
+
+func TestOCSPCheckerValidityInterval(t *testing.T) {
+
+	ca := newTestCA(t, "ca", nil)
+
+	var thisUpdate, nextUpdate time.Time
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+
+		response, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+		}, ca.key)
+		require.NoError(t, err)
+		w.Write(response)
+	}))
+	defer responder.Close()
+
+	leaf := newTestCertificate(t, &x509.Certificate{
+		Subject:    pkix.Name{CommonName: "signer"},
+		KeyUsage:   x509.KeyUsageDigitalSignature,
+		OCSPServer: []string{responder.URL},
+	}, ca)
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		thisUpdate time.Time
+		nextUpdate time.Time
+		err        string
+	}{
+		{name: "Valid", thisUpdate: now.Add(-time.Minute), nextUpdate: now.Add(time.Hour)},
+		{name: "Without next update", thisUpdate: now.Add(-time.Hour)},
+		{name: "Within clock skew", thisUpdate: now.Add(time.Minute), nextUpdate: now.Add(-time.Minute)},
+		{name: "Stale", thisUpdate: now.Add(-2 * time.Hour), nextUpdate: now.Add(-time.Hour), err: "stale"},
+		{name: "Not valid yet", thisUpdate: now.Add(time.Hour), nextUpdate: now.Add(2 * time.Hour), err: "not valid yet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thisUpdate, nextUpdate = tt.thisUpdate, tt.nextUpdate
+
+			err := OCSPChecker{}.CheckRevocation(leaf.cert, ca.cert)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package jwtauth provides net/http middlewares authenticating requests with
+// bearer tokens validated by jwt/v2 and authorizing them with their scopes or
+// roles.
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/9spokes/go/api"
+	"github.com/9spokes/go/jwt/v2"
+	"github.com/9spokes/go/logging/v3"
+)
+
+// Claims holds the claims of the token authenticating a request.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	Scopes    []string
+	Roles     []string
+	ExpiresAt time.Time
+	// All the claims of the token
+	Raw map[string]interface{}
+}
+
+// HasScope reports whether the token has been granted the scope.
+func (c *Claims) HasScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+// HasRole reports whether the token holds the role.
+func (c *Claims) HasRole(role string) bool {
+	return contains(c.Roles, role)
+}
+
+// Options holds the parameters of Authenticate.
+type Options struct {
+	// Checks performed on the token claims, e.g. issuers and audiences
+	Validate jwt.ValidateOptions
+	// Name of the claim holding the roles, "roles" if not set
+	RolesClaim string
+	// Realm sent in the WWW-Authenticate header, not sent if empty
+	Realm string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the claims.
+func NewContext(c context.Context, claims *Claims) context.Context {
+	return context.WithValue(c, contextKey{}, claims)
+}
+
+// FromContext returns the claims of the token authenticating the request.
+func FromContext(c context.Context) (*Claims, bool) {
+	claims, ok := c.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// Authenticate returns a middleware validating the bearer token of the
+// Authorization header and adding its claims to the request context. Requests
+// without a valid token are rejected with a 401 response.
+func Authenticate(ctx *jwt.Context, opts Options) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			token := bearerToken(r)
+			if token == "" {
+				unauthorized(w, r, opts.Realm, "", "missing bearer token")
+				return
+			}
+
+			raw, err := ctx.ValidateWithOptions(token, opts.Validate)
+			if err != nil {
+				logging.Debugf("Rejected bearer token [URI: %s]: %s", r.RequestURI, err.Error())
+
+				message := "invalid token"
+				var claimErr *jwt.ClaimError
+				if errors.As(err, &claimErr) {
+					message = claimErr.Error()
+				}
+				unauthorized(w, r, opts.Realm, "invalid_token", message)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), newClaims(raw, opts))))
+		})
+	}
+}
+
+// RequireScopes returns a middleware rejecting the requests whose token has
+// not been granted all the scopes with a 403 response. It must be used after
+// Authenticate.
+func RequireScopes(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			claims, ok := FromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "", "", "missing bearer token")
+				return
+			}
+
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+					api.ErrorResponseWithCorrelation(w, fmt.Sprintf("missing scope '%s'", scope), r.Header.Get(api.CorrelationIDHeader), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles returns a middleware rejecting the requests whose token holds
+// none of the roles with a 403 response. It must be used after Authenticate.
+func RequireRoles(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			claims, ok := FromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "", "", "missing bearer token")
+				return
+			}
+
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			api.ErrorResponseWithCorrelation(w, "insufficient role", r.Header.Get(api.CorrelationIDHeader), http.StatusForbidden)
+		})
+	}
+}
+
+// Returns the token of the Authorization header, empty if there is none
+func bearerToken(r *http.Request) string {
+
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+// Replies with a 401 response and the WWW-Authenticate header of RFC 6750
+func unauthorized(w http.ResponseWriter, r *http.Request, realm, code, message string) {
+
+	challenge := []string{}
+	if realm != "" {
+		challenge = append(challenge, fmt.Sprintf(`realm="%s"`, realm))
+	}
+	if code != "" {
+		challenge = append(challenge, fmt.Sprintf(`error="%s"`, code), fmt.Sprintf(`error_description="%s"`, message))
+	}
+
+	header := "Bearer"
+	if len(challenge) > 0 {
+		header += " " + strings.Join(challenge, ", ")
+	}
+
+	w.Header().Set("WWW-Authenticate", header)
+	api.ErrorResponseWithCorrelation(w, message, r.Header.Get(api.CorrelationIDHeader), http.StatusUnauthorized)
+}
+
+func newClaims(raw map[string]interface{}, opts Options) *Claims {
+
+	rolesClaim := opts.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+
+	claims := &Claims{
+		Subject:  stringClaim(raw["sub"]),
+		Issuer:   stringClaim(raw["iss"]),
+		Audience: listClaim(raw["aud"]),
+		Roles:    listClaim(raw[rolesClaim]),
+		Raw:      raw,
+	}
+
+	// OAuth2 uses a space separated scope claim, some providers an scp array
+	claims.Scopes = listClaim(raw["scope"])
+	if len(claims.Scopes) == 0 {
+		claims.Scopes = listClaim(raw["scp"])
+	}
+
+	if exp, ok := raw["exp"].(float64); ok {
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return claims
+}
+
+func stringClaim(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// Returns a claim which is either a space separated string or an array of
+// strings as a list
+func listClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9spokes/go/api"
+	"github.com/9spokes/go/jwt/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ctx := &jwt.Context{TrustedKeys: map[string]crypto.PublicKey{"test": &key.PublicKey}}
+	sign := func(claims map[string]interface{}) string {
+		token, err := ctx.Sign(claims, jwt.SignOptions{Signer: key, KeyID: "test"})
+		require.NoError(t, err)
+		return token
+	}
+
+	exp := time.Now().Add(time.Minute).Unix()
+
+	r := mux.NewRouter()
+	r.Use(Authenticate(ctx, Options{Validate: jwt.ValidateOptions{Issuers: []string{"https://issuer"}}, Realm: "api"}))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(claims.Subject))
+	}
+	r.HandleFunc("/any", handler)
+	r.Handle("/read", RequireScopes("read")(http.HandlerFunc(handler)))
+	r.Handle("/write", RequireScopes("read", "write")(http.HandlerFunc(handler)))
+	r.Handle("/admin", RequireRoles("admin", "owner")(http.HandlerFunc(handler)))
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		code          int
+		message       string
+		challenge     string
+	}{
+		{
+			name:          "Valid token",
+			path:          "/any",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp}),
+			code:          http.StatusOK,
+		},
+		{
+			name:          "Case insensitive scheme",
+			path:          "/any",
+			authorization: "bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp}),
+			code:          http.StatusOK,
+		},
+		{
+			name:      "Missing token",
+			path:      "/any",
+			code:      http.StatusUnauthorized,
+			message:   "missing bearer token",
+			challenge: `Bearer realm="api"`,
+		},
+		{
+			name:          "Basic authentication",
+			path:          "/any",
+			authorization: "Basic dXNlcjpwYXNz",
+			code:          http.StatusUnauthorized,
+			message:       "missing bearer token",
+		},
+		{
+			name:          "Malformed token",
+			path:          "/any",
+			authorization: "Bearer abc.def.ghi",
+			code:          http.StatusUnauthorized,
+			message:       "invalid token",
+			challenge:     `Bearer realm="api", error="invalid_token", error_description="invalid token"`,
+		},
+		{
+			name:          "Expired token",
+			path:          "/any",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": time.Now().Add(-time.Hour).Unix()}),
+			code:          http.StatusUnauthorized,
+			message:       "exp",
+		},
+		{
+			name:          "Invalid issuer",
+			path:          "/any",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://other", "exp": exp}),
+			code:          http.StatusUnauthorized,
+			message:       "iss",
+		},
+		{
+			name:          "Scope string",
+			path:          "/write",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp, "scope": "read write"}),
+			code:          http.StatusOK,
+		},
+		{
+			name:          "Scope array",
+			path:          "/read",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp, "scp": []string{"read"}}),
+			code:          http.StatusOK,
+		},
+		{
+			name:          "Missing scope",
+			path:          "/write",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp, "scope": "read"}),
+			code:          http.StatusForbidden,
+			message:       "missing scope 'write'",
+			challenge:     `Bearer error="insufficient_scope", scope="read write"`,
+		},
+		{
+			name:          "Any role",
+			path:          "/admin",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp, "roles": []string{"user", "owner"}}),
+			code:          http.StatusOK,
+		},
+		{
+			name:          "Missing role",
+			path:          "/admin",
+			authorization: "Bearer " + sign(map[string]interface{}{"sub": "123", "iss": "https://issuer", "exp": exp, "roles": []string{"user"}}),
+			code:          http.StatusForbidden,
+			message:       "insufficient role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(api.CorrelationIDHeader, "correlation")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, "123", rr.Body.String())
+				return
+			}
+
+			var body struct {
+				Status        string `json:"status"`
+				Message       string `json:"message"`
+				CorrelationID string `json:"correlationId"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+			assert.Equal(t, "err", body.Status)
+			assert.Contains(t, body.Message, tt.message)
+			assert.Equal(t, "correlation", body.CorrelationID)
+			if tt.challenge != "" {
+				assert.Equal(t, tt.challenge, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRequireWithoutAuthenticate(t *testing.T) {
+
+	handler := RequireScopes("read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,99 @@
+// Package webhook provides net/http middlewares rejecting webhook deliveries
+// whose signature is invalid or stale, using the verifiers of the crypto
+// package.
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/9spokes/go/api"
+	"github.com/9spokes/go/crypto"
+	"github.com/9spokes/go/logging/v3"
+)
+
+// MaxBodySize is the maximum size of the deliveries read to verify them.
+var MaxBodySize int64 = 1 << 20
+
+// Verify returns a middleware rejecting the deliveries not verified by the
+// verifier with a 401 response. The body is read to verify it and restored for
+// the next handler. It panics if the verifier is nil.
+func Verify(verifier crypto.WebhookVerifier) func(next http.Handler) http.Handler {
+	if verifier == nil {
+		panic("webhook: nil verifier")
+	}
+	return verifyProvider(nil, nil, verifier)
+}
+
+// VerifyProvider returns a middleware like Verify using the verifier of the
+// registry for the provider of the request, e.g. taken from its path. Requests
+// for unknown providers are rejected with a 404 response. It panics if the
+// registry or the provider function is nil.
+func VerifyProvider(registry *crypto.WebhookRegistry, provider func(r *http.Request) string) func(next http.Handler) http.Handler {
+	if registry == nil {
+		panic("webhook: nil registry")
+	}
+	if provider == nil {
+		panic("webhook: nil provider function")
+	}
+	return verifyProvider(registry, provider, nil)
+}
+
+// Uses the verifier of the provider if there is a registry, the verifier
+// otherwise
+func verifyProvider(registry *crypto.WebhookRegistry, provider func(r *http.Request) string, verifier crypto.WebhookVerifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			correlationID := r.Header.Get(api.CorrelationIDHeader)
+
+			v := verifier
+			if registry != nil {
+				var ok bool
+				if v, ok = registry.Get(provider(r)); !ok {
+					api.ErrorResponseWithCorrelation(w, "unknown webhook provider", correlationID, http.StatusNotFound)
+					return
+				}
+			}
+			if v == nil {
+				logging.Errorf("Misconfigured webhook verifier [URI: %s]: nil verifier", r.RequestURI)
+				api.ErrorResponseWithCorrelation(w, "webhook verifier is misconfigured", correlationID, http.StatusInternalServerError)
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+			r.Body.Close()
+			if err != nil {
+				api.ErrorResponseWithCorrelation(w, "failed to read webhook body", correlationID, http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > MaxBodySize {
+				api.ErrorResponseWithCorrelation(w, "webhook body too large", correlationID, http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			if err := v.Verify(r.Header, body); err != nil {
+				if errors.Is(err, crypto.ErrMissingSecret) {
+					logging.Errorf("Misconfigured webhook verifier [URI: %s]: %s", r.RequestURI, err.Error())
+					api.ErrorResponseWithCorrelation(w, "webhook verifier is misconfigured", correlationID, http.StatusInternalServerError)
+					return
+				}
+
+				logging.Warningf("Rejected webhook delivery [URI: %s]: %s", r.RequestURI, err.Error())
+
+				message := "invalid webhook signature"
+				if errors.Is(err, crypto.ErrStaleWebhook) || errors.Is(err, crypto.ErrMissingSignature) {
+					message = err.Error()
+				}
+				api.ErrorResponseWithCorrelation(w, message, correlationID, http.StatusUnauthorized)
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9spokes/go/crypto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyProvider(t *testing.T) {
+
+	stripe := crypto.StripeVerifier{Secret: "whsec_test"}
+	xero := crypto.HMACSHA256Verifier{Secret: []byte("xero"), Header: "X-Xero-Signature"}
+
+	registry := crypto.NewWebhookRegistry()
+	registry.Register("stripe", stripe)
+	registry.Register("xero", xero)
+
+	r := mux.NewRouter()
+	r.Use(VerifyProvider(registry, func(r *http.Request) string { return mux.Vars(r)["provider"] }))
+	r.HandleFunc("/webhooks/{provider}", func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Write(body)
+	}).Methods("POST")
+
+	body := []byte(`{"id":"evt_1"}`)
+	large := bytes.Repeat([]byte("a"), int(MaxBodySize)+1)
+
+	tests := []struct {
+		name    string
+		path    string
+		header  http.Header
+		body    []byte
+		code    int
+		message string
+	}{
+		{name: "Stripe", path: "/webhooks/stripe", header: stripe.Sign(body, time.Now()), body: body, code: http.StatusOK},
+		{name: "Xero", path: "/webhooks/xero", header: xero.Sign(body, time.Now()), body: body, code: http.StatusOK},
+		{name: "Invalid signature", path: "/webhooks/xero", header: stripe.Sign(body, time.Now()), body: body, code: http.StatusUnauthorized, message: "missing webhook signature"},
+		{name: "Modified body", path: "/webhooks/stripe", header: stripe.Sign(body, time.Now()), body: []byte(`{"id":"evt_2"}`), code: http.StatusUnauthorized, message: "invalid webhook signature"},
+		{name: "Stale delivery", path: "/webhooks/stripe", header: stripe.Sign(body, time.Now().Add(-time.Hour)), body: body, code: http.StatusUnauthorized, message: "outside of the tolerance"},
+		{name: "Unknown provider", path: "/webhooks/quickbooks", header: http.Header{}, body: body, code: http.StatusNotFound, message: "unknown webhook provider"},
+		{name: "Body too large", path: "/webhooks/stripe", header: stripe.Sign(large, time.Now()), body: large, code: http.StatusRequestEntityTooLarge, message: "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, tt.body, rr.Body.Bytes())
+				return
+			}
+
+			var response struct {
+				Message string `json:"message"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Contains(t, response.Message, tt.message)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	verifier := crypto.HMACSHA256Verifier{Secret: []byte("secret"), Header: "X-Signature", Encoding: crypto.SignatureHex}
+	handler := Verify(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	body := []byte(`{"id":"1"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header = verifier.Sign(body, time.Now())
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Deliveries signed with an empty key are never accepted
+	misconfigured := crypto.HMACSHA256Verifier{Header: "X-Signature", Encoding: crypto.SignatureHex}
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header = misconfigured.Sign(body, time.Now())
+	rr = httptest.NewRecorder()
+	Verify(misconfigured)(handler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestVerifyMisconfigured(t *testing.T) {
+
+	registry := crypto.NewWebhookRegistry()
+	provider := func(r *http.Request) string { return "stripe" }
+
+	assert.Panics(t, func() { Verify(nil) })
+	assert.Panics(t, func() { VerifyProvider(nil, provider) })
+	assert.Panics(t, func() { VerifyProvider(registry, nil) })
+
+	registry.Register("stripe", nil)
+	handler := VerifyProvider(registry, provider)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`))))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
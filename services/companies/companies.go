@@ -1,10 +1,12 @@
 package companies
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
 
-	"github.com/9spokes/go/http"
+	"github.com/9spokes/go/api"
+	Http "github.com/9spokes/go/http/v2"
 )
 
 // Context represents a company object into the profile service
@@ -12,14 +14,23 @@ type Context struct {
 	URL          string
 	ClientID     string
 	ClientSecret string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 //GetCompanies returns a list of companies that the user belongs to
 func (ctx Context) GetCompanies(user string) ([]Company, error) {
+	return ctx.GetCompaniesContext(context.Background(), user)
+}
+
+// GetCompaniesContext is like GetCompanies but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) GetCompaniesContext(c context.Context, user string) ([]Company, error) {
 
-	response, err := http.Request{
-		URL: fmt.Sprintf("%s/companies", ctx.URL),
-		Authentication: http.Authentication{
+	response, err := (&Http.Request{
+		URL:    fmt.Sprintf("%s/companies", ctx.URL),
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
@@ -27,26 +38,16 @@ func (ctx Context) GetCompanies(user string) ([]Company, error) {
 		Headers: map[string]string{
 			"x-9sp-user": user,
 		},
-		ContentType: "application/json",
-	}.Get()
+	}).Get(c)
 
 	if err != nil {
 		return nil, fmt.Errorf("while interacting with Profile service: %s", err.Error())
 	}
 
-	var ret struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Details []Company
-	}
-
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling message: %s", err.Error())
-	}
-
-	if ret.Status != "ok" {
-		return nil, fmt.Errorf(ret.Message)
+	var companies []Company
+	if _, err := api.Decode(response.Response, response.Payload, &companies); err != nil {
+		return nil, err
 	}
 
-	return ret.Details, nil
+	return companies, nil
 }
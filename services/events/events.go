@@ -1,15 +1,19 @@
 package events
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 )
 
 // Context represents the coordinates of the event service
 type Context struct {
 	url string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 // New returns a new event context object
@@ -24,17 +28,30 @@ func New(url string) (*Context, error) {
 
 // Post is a method that writes a new user-based event to a central logging database.
 func (svc *Context) Post(event Event) error {
+	return svc.PostContext(context.Background(), event)
+}
+
+// PostContext is like Post but the context can be used to set a timeout or
+// cancel the request.
+func (svc *Context) PostContext(ctx context.Context, event Event) error {
 
 	encoded, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("while marshaling fields: %s", err.Error())
 	}
 
-	_, err = http.Request{
-		Body:        encoded,
-		ContentType: "application/json",
-		URL:         svc.url,
-	}.Post()
+	response, err := (&Http.Request{
+		Body:   encoded,
+		URL:    svc.url,
+		Client: svc.Client,
+	}).Post(ctx)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode > 399 {
+		return fmt.Errorf("non-OK response: %s", response.Payload)
+	}
 
-	return err
+	return nil
 }
@@ -1,10 +1,12 @@
 package extractor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v2"
 )
 
@@ -13,21 +15,29 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	Logger       *logging.Logger
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 // ImmediateETL takes a connection ID and notifies the extractor to kick off the connection based Immediate ETL.
 func (ctx Context) ImmediateETL(conn string) error {
+	return ctx.ImmediateETLContext(context.Background(), conn)
+}
+
+// ImmediateETLContext is like ImmediateETL but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) ImmediateETLContext(c context.Context, conn string) error {
 
-	response, err := http.Request{
-		URL: ctx.URL,
-		Authentication: http.Authentication{
+	response, err := (&Http.Request{
+		URL:    ctx.URL,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
 		},
-		ContentType: "application/json",
-		Body:        []byte(fmt.Sprintf("{\"connection\":\"%s\"}", conn)),
-	}.Post()
+		Body: []byte(fmt.Sprintf("{\"connection\":\"%s\"}", conn)),
+	}).Post(c)
 
 	if err != nil {
 		return fmt.Errorf("while interacting with extractor-ng service: %s", err.Error())
@@ -38,7 +48,7 @@ func (ctx Context) ImmediateETL(conn string) error {
 		Message string `json:"message"`
 	}
 
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
+	if err := json.Unmarshal(response.Payload, &ret); err != nil {
 		return fmt.Errorf("while unmarshalling message: %s", err.Error())
 	}
 
@@ -1,14 +1,15 @@
 package indexer
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
-	"github.com/9spokes/go/http"
+	"github.com/9spokes/go/api"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v3"
 )
 
@@ -18,51 +19,65 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	Logger       *logging.Logger
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 var (
-	ErrNotFound = errors.New("not found")
+	// ErrNotFound is returned, wrapped, when the requested index does not exist.
+	ErrNotFound = api.ErrNotFound
 )
 
+// Returns a new request to the Indexer service authenticated with the client
+// credentials.
+func (ctx *Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
+			Scheme:   "basic",
+			Username: ctx.ClientID,
+			Password: ctx.ClientSecret,
+		},
+	}
+}
+
 // NewIndex creates a new index for a given connection and datasource.  It returns the new index document
 func (ctx *Context) NewIndex(index *Index) (*Index, error) {
+	return ctx.NewIndexContext(context.Background(), index)
+}
+
+// NewIndexContext is like NewIndex but the context can be used to set a timeout
+// or cancel the request.
+func (ctx *Context) NewIndexContext(c context.Context, index *Index) (*Index, error) {
 
 	// New post-Indexer message
-	raw, err := http.Request{
-		ContentType: "application/x-www-form-urlencoded",
-		URL:         ctx.URL + "/connections",
-		Body: []byte(fmt.Sprintf("connection=%s&datasource=%s&count=%d&type=%s&storage=%s&cycle=%s&osp=%s&notify=%t&depends=%s&webhooks=%t",
-			index.Connection,
-			index.Datasource,
-			index.Count,
-			index.Type,
-			index.Storage,
-			index.Cycle,
-			index.OSP,
-			index.Notify,
-			strings.Join(index.Dependencies, ","),
-			index.Webhooks,
-		)),
-		Authentication: http.Authentication{Scheme: "basic", Username: ctx.ClientID, Password: ctx.ClientSecret},
-	}.Post()
+	req := ctx.request(ctx.URL + "/connections")
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = []byte(fmt.Sprintf("connection=%s&datasource=%s&count=%d&type=%s&storage=%s&cycle=%s&osp=%s&notify=%t&depends=%s&webhooks=%t",
+		index.Connection,
+		index.Datasource,
+		index.Count,
+		index.Type,
+		index.Storage,
+		index.Cycle,
+		index.OSP,
+		index.Notify,
+		strings.Join(index.Dependencies, ","),
+		index.Webhooks,
+	))
+
+	raw, err := req.Post(c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new index: %s", err.Error())
 	}
 
-	var response struct {
-		Status  string `json:"status,omitempty"`
-		Message string `json:"message,omitempty"`
-		Details Index  `json:"details,omitempty"`
-	}
-	if err := json.Unmarshal(raw.Body, &response); err != nil {
-		return nil, fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if response.Status != "ok" {
-		return nil, fmt.Errorf("non-ok response from the Indexer service: %s", response.Message)
+	var idx Index
+	if _, err := api.Decode(raw.Response, raw.Payload, &idx); err != nil {
+		return nil, fmt.Errorf("non-ok response from the Indexer service: %w", err)
 	}
 
-	return response.Details.updateData()
+	return idx.updateData()
 }
 
 func (ds *Index) updateData() (*Index, error) {
@@ -116,7 +131,13 @@ func (ds *Index) updateData() (*Index, error) {
 }
 
 // GetIndex returns a connection by ID from the designated indexer service instance
-func (ctx *Context) GetIndex(conn, datasource, cycle string) (idx *Index, err error) {
+func (ctx *Context) GetIndex(conn, datasource, cycle string) (*Index, error) {
+	return ctx.GetIndexContext(context.Background(), conn, datasource, cycle)
+}
+
+// GetIndexContext is like GetIndex but the context can be used to set a
+// timeout or cancel the request.
+func (ctx *Context) GetIndexContext(c context.Context, conn, datasource, cycle string) (idx *Index, err error) {
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -129,15 +150,7 @@ func (ctx *Context) GetIndex(conn, datasource, cycle string) (idx *Index, err er
 
 	logging.Debugf("Invoking Indexer service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(url).Get(c)
 
 	if response != nil && response.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
@@ -147,25 +160,22 @@ func (ctx *Context) GetIndex(conn, datasource, cycle string) (idx *Index, err er
 		return nil, fmt.Errorf("error invoking Indexer service at: %s: %s", url, err.Error())
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Details Index  `json:"details"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return nil, fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
+	var index Index
+	if _, err := api.Decode(response.Response, response.Payload, &index); err != nil {
+		return nil, fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
-	if parsed.Status != "ok" {
-		return nil, fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
-	}
-
-	return parsed.Details.updateData()
+	return index.updateData()
 }
 
 // UpdateIndex updates an entry with the data provided
 func (ctx *Context) UpdateIndex(conn, datasource, cycle, index, outcome string, ok, retry bool) error {
+	return ctx.UpdateIndexContext(context.Background(), conn, datasource, cycle, index, outcome, ok, retry)
+}
+
+// UpdateIndexContext is like UpdateIndex but the context can be used to set a
+// timeout or cancel the request.
+func (ctx *Context) UpdateIndexContext(c context.Context, conn, datasource, cycle, index, outcome string, ok, retry bool) error {
 
 	location := fmt.Sprintf("%s/connections/%s/%s?cycle=%s&index=%s", ctx.URL, conn, datasource, cycle, index)
 
@@ -181,32 +191,17 @@ func (ctx *Context) UpdateIndex(conn, datasource, cycle, index, outcome string,
 	params.Add("status", status)
 	params.Add("retry", fmt.Sprintf("%t", retry))
 
-	response, err := http.Request{
-		URL: location,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/x-www-form-urlencoded",
-		Body:        []byte(params.Encode()),
-	}.Put()
+	req := ctx.request(location)
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = []byte(params.Encode())
 
+	response, err := req.Put(c)
 	if err != nil {
 		return fmt.Errorf("error invoking Indexer service at: %s: %s", location, err.Error())
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if parsed.Status != "ok" {
-		return fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
 	return nil
@@ -215,59 +210,46 @@ func (ctx *Context) UpdateIndex(conn, datasource, cycle, index, outcome string,
 // GetDatasourceStatus returns the datasource status from the designated indexer service
 // instance.
 func (ctx *Context) GetDatasourceStatus(conn, datasource string) (*IndexStatus, error) {
+	return ctx.GetDatasourceStatusContext(context.Background(), conn, datasource)
+}
+
+// GetDatasourceStatusContext is like GetDatasourceStatus but the context can be
+// used to set a timeout or cancel the request.
+func (ctx *Context) GetDatasourceStatusContext(c context.Context, conn, datasource string) (*IndexStatus, error) {
 
 	url := fmt.Sprintf("%s/connections/%s/%s/status", ctx.URL, conn, datasource)
 
 	logging.Debugf("Invoking Indexer service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(url).Get(c)
 
 	if err != nil {
 		return nil, fmt.Errorf("error invoking Indexer service at: %s: %s", url, err.Error())
 	}
 
-	var parsed struct {
-		Status  string       `json:"status"`
-		Message string       `json:"message"`
-		Details *IndexStatus `json:"details"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return nil, fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if parsed.Status != "ok" {
-		return nil, fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
+	var status IndexStatus
+	if _, err := api.Decode(response.Response, response.Payload, &status); err != nil {
+		return nil, fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
-	return parsed.Details, nil
+	return &status, nil
 }
 
 // GetConnectionStatus returns the statuses of all datasources belonging to the
 // specified connection.
 func (ctx *Context) GetConnectionStatus(conn string) ([]*IndexStatus, error) {
+	return ctx.GetConnectionStatusContext(context.Background(), conn)
+}
+
+// GetConnectionStatusContext is like GetConnectionStatus but the context can be
+// used to set a timeout or cancel the request.
+func (ctx *Context) GetConnectionStatusContext(c context.Context, conn string) ([]*IndexStatus, error) {
 
 	url := fmt.Sprintf("%s/connections/%s/status", ctx.URL, conn)
 
 	logging.Debugf("Invoking Indexer service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(url).Get(c)
 
 	if response != nil && response.StatusCode == http.StatusNotFound {
 		return nil, ErrNotFound
@@ -277,19 +259,10 @@ func (ctx *Context) GetConnectionStatus(conn string) ([]*IndexStatus, error) {
 		return nil, fmt.Errorf("error invoking Indexer service at: %s: %s", url, err.Error())
 	}
 
-	var parsed struct {
-		Status  string         `json:"status"`
-		Message string         `json:"message"`
-		Details []*IndexStatus `json:"details"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return nil, fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if parsed.Status != "ok" {
-		return nil, fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
+	var statuses []*IndexStatus
+	if _, err := api.Decode(response.Response, response.Payload, &statuses); err != nil {
+		return nil, fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
-	return parsed.Details, nil
+	return statuses, nil
 }
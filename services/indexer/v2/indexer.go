@@ -1,11 +1,13 @@
 package index
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 
-	"github.com/9spokes/go/http"
+	"github.com/9spokes/go/api"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v3"
 )
 
@@ -15,14 +17,37 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	Logger       *logging.Logger
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 var (
-	ErrNotFound = errors.New("not found")
+	// ErrNotFound is returned when the connection has no indexes.
+	ErrNotFound = api.ErrNotFound
 )
 
+// Returns a new request to the Indexer service authenticated with the client
+// credentials.
+func (ctx *Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
+			Scheme:   "basic",
+			Username: ctx.ClientID,
+			Password: ctx.ClientSecret,
+		},
+	}
+}
+
 // GetIndexes returns a connection by ID from the designated indexer service instance
 func (ctx *Context) GetIndexes(conn string) (map[string][]IndexEntry, error) {
+	return ctx.GetIndexesContext(context.Background(), conn)
+}
+
+// GetIndexesContext is like GetIndexes but the context can be used to set a
+// timeout or cancel the request.
+func (ctx *Context) GetIndexesContext(c context.Context, conn string) (map[string][]IndexEntry, error) {
 
 	indexes := make(map[string][]IndexEntry)
 
@@ -37,15 +62,7 @@ func (ctx *Context) GetIndexes(conn string) (map[string][]IndexEntry, error) {
 
 	logging.Debugf("Invoking Indexer service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(url).Get(c)
 
 	if response != nil && response.StatusCode == http.StatusNotFound {
 		return indexes, ErrNotFound
@@ -55,27 +72,21 @@ func (ctx *Context) GetIndexes(conn string) (map[string][]IndexEntry, error) {
 		return indexes, fmt.Errorf("error invoking Indexer service at: %s: %s", url, err.Error())
 	}
 
-	var parsed struct {
-		Status  string                  `json:"status"`
-		Message string                  `json:"message"`
-		Details map[string][]IndexEntry `json:"details"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return indexes, fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if parsed.Status != "ok" {
-		return indexes, fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
+	if _, err := api.Decode(response.Response, response.Payload, &indexes); err != nil {
+		return indexes, fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
-	indexes = parsed.Details
-
 	return indexes, nil
 }
 
 // UpdateIndex updates an entry with the data provided
 func (ctx *Context) UpdateIndex(connection, osp, datasource, cycle string, updatedIndexes []IndexEntry) error {
+	return ctx.UpdateIndexContext(context.Background(), connection, osp, datasource, cycle, updatedIndexes)
+}
+
+// UpdateIndexContext is like UpdateIndex but the context can be used to set a
+// timeout or cancel the request.
+func (ctx *Context) UpdateIndexContext(c context.Context, connection, osp, datasource, cycle string, updatedIndexes []IndexEntry) error {
 
 	location := fmt.Sprintf("%s/connections", ctx.URL)
 
@@ -91,32 +102,17 @@ func (ctx *Context) UpdateIndex(connection, osp, datasource, cycle string, updat
 
 	body, _ := json.Marshal(update)
 
-	response, err := http.Request{
-		URL: location,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/x-www-form-urlencoded",
-		Body:        body,
-	}.Put()
+	req := ctx.request(location)
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = body
 
+	response, err := req.Put(c)
 	if err != nil {
 		return fmt.Errorf("error invoking Indexer service at: %s: %s", location, err.Error())
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
-
-	if err := json.Unmarshal(response.Body, &parsed); err != nil {
-		return fmt.Errorf("error parsing response from Indexer service: %s", err.Error())
-	}
-
-	if parsed.Status != "ok" {
-		return fmt.Errorf("non-OK response received from Indexer service: %s", parsed.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("non-OK response received from Indexer service: %w", err)
 	}
 
 	return nil
@@ -124,41 +120,38 @@ func (ctx *Context) UpdateIndex(connection, osp, datasource, cycle string, updat
 
 // NewIndex creates a new index for a given connection and datasource.  It returns the new index document
 func (ctx *Context) NewIndex(index *Index) (*Index, error) {
+	return ctx.NewIndexContext(context.Background(), index)
+}
+
+// NewIndexContext is like NewIndex but the context can be used to set a timeout
+// or cancel the request.
+func (ctx *Context) NewIndexContext(c context.Context, index *Index) (*Index, error) {
 
 	// New post-Indexer message
-	raw, err := http.Request{
-		ContentType: "application/x-www-form-urlencoded",
-		URL:         ctx.URL + "/connections",
-		Body: []byte(fmt.Sprintf("connection=%s&datasource=%s&count=%d&type=%s&storage=%s&cycle=%s&osp=%s&notify=%t&new_etl=%t&webhooks=%t",
-			index.Connection,
-			index.Datasource,
-			index.Count,
-			index.Type,
-			index.Storage,
-			index.Cycle,
-			index.OSP,
-			index.Notify,
-			index.NewETL,
-			index.Webhooks,
-		)),
-		Authentication: http.Authentication{Scheme: "basic", Username: ctx.ClientID, Password: ctx.ClientSecret},
-	}.Post()
+	req := ctx.request(ctx.URL + "/connections")
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = []byte(fmt.Sprintf("connection=%s&datasource=%s&count=%d&type=%s&storage=%s&cycle=%s&osp=%s&notify=%t&new_etl=%t&webhooks=%t",
+		index.Connection,
+		index.Datasource,
+		index.Count,
+		index.Type,
+		index.Storage,
+		index.Cycle,
+		index.OSP,
+		index.Notify,
+		index.NewETL,
+		index.Webhooks,
+	))
+
+	raw, err := req.Post(c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new index: %s", err.Error())
 	}
 
-	var response struct {
-		Status  string `json:"status,omitempty"`
-		Message string `json:"message,omitempty"`
-		Details Index  `json:"details,omitempty"`
-	}
-	if err := json.Unmarshal(raw.Body, &response); err != nil {
-		return nil, fmt.Errorf("error parsing response from indexer service: %s", err.Error())
-	}
-
-	if response.Status != "ok" {
-		return nil, fmt.Errorf("received an error response from the indexer service: %s", response.Message)
+	var idx Index
+	if _, err := api.Decode(raw.Response, raw.Payload, &idx); err != nil {
+		return nil, fmt.Errorf("received an error response from the indexer service: %w", err)
 	}
 
-	return &response.Details, nil
+	return &idx, nil
 }
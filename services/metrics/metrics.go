@@ -1,12 +1,15 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
 
-	"github.com/9spokes/go/http"
+	"github.com/9spokes/go/api"
+	Http "github.com/9spokes/go/http/v2"
 )
 
 // Context represents a company object into the profile service
@@ -14,10 +17,32 @@ type Context struct {
 	URL          string
 	ClientID     string
 	ClientSecret string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
+}
+
+// Returns a new request to the Metrics service authenticated with the client
+// credentials.
+func (ctx Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
+			Scheme:   "basic",
+			Username: ctx.ClientID,
+			Password: ctx.ClientSecret,
+		},
+	}
 }
 
 //GetTimeSeriesMetric calculates a metric based on the supplied criteria and returns an answer.
 func (ctx Context) GetTimeSeriesMetric(category string, metric string, q Query) (*TimeSeries, error) {
+	return ctx.GetTimeSeriesMetricContext(context.Background(), category, metric, q)
+}
+
+// GetTimeSeriesMetricContext is like GetTimeSeriesMetric but the context can be
+// used to set a timeout or cancel the request.
+func (ctx Context) GetTimeSeriesMetricContext(c context.Context, category string, metric string, q Query) (*TimeSeries, error) {
 
 	if category == "" {
 		return nil, fmt.Errorf("Invalid metric category %s", category)
@@ -30,59 +55,44 @@ func (ctx Context) GetTimeSeriesMetric(category string, metric string, q Query)
 	u, err := url.Parse(ctx.URL)
 	u.Path = path.Join(u.Path, category, "metrics", metric)
 
-	res, err := http.Request{
-		URL: u.String(),
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-	}.Get()
+	res, err := ctx.request(u.String()).Get(c)
 
 	if err != nil {
 		return nil, err
 	}
 
-	type response struct {
-		Status  string     `json:"status"`
-		Message string     `json:"message"`
-		Details TimeSeries `json:"details"`
-	}
-
-	var ret response
-	if err := json.Unmarshal(res.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling response: %s", err.Error())
-	}
-
-	if ret.Status != "ok" {
-		return nil, fmt.Errorf(ret.Message)
+	var ts TimeSeries
+	if _, err := api.Decode(res.Response, res.Payload, &ts); err != nil {
+		return nil, err
 	}
 
-	return &ret.Details, nil
+	return &ts, nil
 }
 
 //GetAvailableDatapoints get all the available datapoints configured in the metric service.
 func (ctx Context) GetAvailableDatapoints() (*MetricServiceResponse, error) {
+	return ctx.GetAvailableDatapointsContext(context.Background())
+}
+
+// GetAvailableDatapointsContext is like GetAvailableDatapoints but the context
+// can be used to set a timeout or cancel the request.
+func (ctx Context) GetAvailableDatapointsContext(c context.Context) (*MetricServiceResponse, error) {
 
 	var metricRes MetricServiceResponse
 	var err error
-	var response *http.Response
+	var response *Http.Response
 
-	response, err = http.Request{
-		URL: ctx.URL + "/datapoints",
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err = ctx.request(ctx.URL + "/datapoints").Get(c)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(response.Body, &metricRes)
+	if response.StatusCode > 399 {
+		return nil, api.NewError(response.Response, response.Payload)
+	}
+
+	err = json.Unmarshal(response.Payload, &metricRes)
 	if err != nil {
 		return nil, fmt.Errorf("while unmarshaling response: %s", err.Error())
 	}
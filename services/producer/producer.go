@@ -1,11 +1,12 @@
 package producer
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/9spokes/go/api"
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v3"
 	"github.com/9spokes/go/types"
 )
@@ -16,43 +17,55 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	Logger       *logging.Logger
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
-// ImmediateETL takes a connection ID and notifies the producer to kick off the Immediate ETL cycle for that particular connection. If datasource and cycle is not provided, it will trigger extraction for all datasources in the configuration.
-func (ctx Context) ImmediateETL(conn, osp, ds, cycle string) error {
-
-	response, err := http.Request{
-		URL: ctx.URL,
-		Authentication: http.Authentication{
+// Returns a new request to the Producer service authenticated with the client
+// credentials.
+func (ctx Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
 		},
-		ContentType: "application/json",
-		Body:        []byte(fmt.Sprintf("{\"connection\":\"%s\", \"osp\":\"%s\", \"datasource\":\"%s\", \"cycle\":\"%s\"}", conn, osp, ds, cycle)),
-	}.Post()
-
-	if err != nil {
-		return fmt.Errorf("while interacting with Producer service: %s", err.Error())
 	}
+}
 
-	var ret struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
+// ImmediateETL takes a connection ID and notifies the producer to kick off the Immediate ETL cycle for that particular connection. If datasource and cycle is not provided, it will trigger extraction for all datasources in the configuration.
+func (ctx Context) ImmediateETL(conn, osp, ds, cycle string) error {
+	return ctx.ImmediateETLContext(context.Background(), conn, osp, ds, cycle)
+}
+
+// ImmediateETLContext is like ImmediateETL but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) ImmediateETLContext(c context.Context, conn, osp, ds, cycle string) error {
 
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return fmt.Errorf("while unmarshalling message: %s", err.Error())
+	req := ctx.request(ctx.URL)
+	req.Body = []byte(fmt.Sprintf("{\"connection\":\"%s\", \"osp\":\"%s\", \"datasource\":\"%s\", \"cycle\":\"%s\"}", conn, osp, ds, cycle))
+
+	response, err := req.Post(c)
+	if err != nil {
+		return fmt.Errorf("while interacting with Producer service: %s", err.Error())
 	}
 
-	if ret.Status != "ok" {
-		return fmt.Errorf(ret.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return err
 	}
 
 	return nil
 }
 
 func (ctx Context) GetSchedules(organization string, app, datasource *string) ([]types.Schedule, error) {
+	return ctx.GetSchedulesContext(context.Background(), organization, app, datasource)
+}
+
+// GetSchedulesContext is like GetSchedules but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) GetSchedulesContext(c context.Context, organization string, app, datasource *string) ([]types.Schedule, error) {
 	logging.Infof("Getting schedules organization %q, app %v, datasource %v", organization, app, datasource)
 
 	query := make(map[string]string)
@@ -63,28 +76,17 @@ func (ctx Context) GetSchedules(organization string, app, datasource *string) ([
 		query["datasource"] = *datasource
 	}
 
-	response, err := http.Request{
-		URL: fmt.Sprintf("%s/organizations/%s/schedule", ctx.URL, organization),
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		Query:       query,
-		ContentType: "application/json",
-	}.Get()
+	req := ctx.request(fmt.Sprintf("%s/organizations/%s/schedule", ctx.URL, organization))
+	req.Query = query
+
+	response, err := req.Get(c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to producer for getting schedules: %s", err.Error())
 	}
 
-	var res api.Response
-	if err := json.Unmarshal(response.Body, &res); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal json into response: %s", err.Error())
-	}
-
-	schedules, ok := res.Details.([]types.Schedule)
-	if !ok {
-		return nil, fmt.Errorf("details(%T) from response is not type of []Schedule", res.Details)
+	var schedules []types.Schedule
+	if _, err := api.Decode(response.Response, response.Payload, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
 	}
 
 	logging.Infof("Fetched %d schedules", len(schedules))
@@ -1,12 +1,13 @@
 package profile
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	"github.com/9spokes/go/api"
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 )
 
 // Context represents a company object into the profile service
@@ -15,34 +16,47 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	User         string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
-//UpdateProfile updates the user profile based on the contents of the session
-func (ctx Context) UpdateProfile(form *url.Values) error {
-
-	response, err := http.Request{
-		URL:         ctx.URL,
-		ContentType: "application/x-www-form-urlencoded",
-		Authentication: http.Authentication{
+// Returns a new request to the Profile service authenticated with the client
+// credentials and acting on behalf of the context user.
+func (ctx Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
 		},
-		Headers: map[string]string{"x-9sp-user": ctx.User},
-		Body:    []byte(form.Encode()),
-	}.Put()
+		Headers: map[string]string{
+			"x-9sp-user": ctx.User,
+		},
+	}
+}
 
+//UpdateProfile updates the user profile based on the contents of the session
+func (ctx Context) UpdateProfile(form *url.Values) error {
+	return ctx.UpdateProfileContext(context.Background(), form)
+}
+
+// UpdateProfileContext is like UpdateProfile but the context can be used to set
+// a timeout or cancel the request.
+func (ctx Context) UpdateProfileContext(c context.Context, form *url.Values) error {
+
+	req := ctx.request(ctx.URL)
+	req.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	req.Body = []byte(form.Encode())
+
+	response, err := req.Put(c)
 	if err != nil {
 		return err
 	}
 
-	var ret api.Response
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return fmt.Errorf("while unmarshalling response: %s", err.Error())
-	}
-
-	if ret.Status != "ok" {
-		return fmt.Errorf(ret.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return err
 	}
 
 	return nil
@@ -52,78 +66,56 @@ func (ctx Context) UpdateProfile(form *url.Values) error {
 // only those options whose names match the filter get returned. The filter can be
 // a plain string or a regex.
 func (ctx Context) GetUserOptions(filter string) (map[string]interface{}, error) {
+	return ctx.GetUserOptionsContext(context.Background(), filter)
+}
+
+// GetUserOptionsContext is like GetUserOptions but the context can be used to
+// set a timeout or cancel the request.
+func (ctx Context) GetUserOptionsContext(c context.Context, filter string) (map[string]interface{}, error) {
 
 	optionsURL := fmt.Sprintf("%s/user/options", ctx.URL)
-	
-	request := http.Request{
-		URL: optionsURL,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		Headers: map[string]string{
-			"x-9sp-user": ctx.User,
-		},
-		ContentType: "application/json",
-	}
-	
+
+	request := ctx.request(optionsURL)
+
 	if filter != "" {
 		request.Query = map[string]string{
 			"q": filter,
 		}
 	}
 
-	response, err := request.Get()
+	response, err := request.Get(c)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user options %s", err.Error())
 	}
 
-	var ret api.Response
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling options: %s", err.Error())
+	var options map[string]interface{}
+	if _, err := api.Decode(response.Response, response.Payload, &options); err != nil {
+		return nil, err
 	}
 
-	if ret.Status != "ok" {
-		return nil, fmt.Errorf(ret.Message)
-	}
-
-	if _, ok := ret.Details.(map[string]interface{}); !ok {
-		return nil, fmt.Errorf("return type is %T, not a map", ret.Details)
-	}
-
-	return ret.Details.(map[string]interface{}), nil
+	return options, nil
 }
 
 // GetOption retrieves a single user option
 func (ctx Context) GetUserOption(option string) (interface{}, error) {
+	return ctx.GetUserOptionContext(context.Background(), option)
+}
+
+// GetUserOptionContext is like GetUserOption but the context can be used to set
+// a timeout or cancel the request.
+func (ctx Context) GetUserOptionContext(c context.Context, option string) (interface{}, error) {
 
 	optionsURL := fmt.Sprintf("%s/user/options/%s", ctx.URL, option)
 
-	response, err := http.Request{
-		URL: optionsURL,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		Headers: map[string]string{
-			"x-9sp-user": ctx.User,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(optionsURL).Get(c)
 
 	if err != nil {
 		return nil, fmt.Errorf("error getting user option %s: %s", option, err.Error())
 	}
 
-	var ret api.Response
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling option %s: %s", option, err.Error())
-	}
-
-	if ret.Status != "ok" {
-		return nil, fmt.Errorf(ret.Message)
+	ret, err := api.Decode(response.Response, response.Payload, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	return ret.Details, nil
@@ -131,38 +123,24 @@ func (ctx Context) GetUserOption(option string) (interface{}, error) {
 
 //GetProfile get user's profile by userId
 func (ctx Context) GetProfile(user string) (*Profile, error) {
+	return ctx.GetProfileContext(context.Background(), user)
+}
+
+// GetProfileContext is like GetProfile but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) GetProfileContext(c context.Context, user string) (*Profile, error) {
 	profileURL := fmt.Sprintf("%s/users/%s", ctx.URL, user)
 
-	response, err := http.Request{
-		URL: profileURL,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		Headers: map[string]string{
-			"x-9sp-user": ctx.User,
-		},
-		ContentType: "application/json",
-	}.Get()
+	response, err := ctx.request(profileURL).Get(c)
 
 	if err != nil {
 		return nil, fmt.Errorf("error getting user profile %s: %v", user, err)
 	}
 
-	var ret struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Details Profile
-	}
-
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling user profile %s: %v", user, err)
-	}
-
-	if ret.Status != "ok" {
-		return nil, fmt.Errorf(ret.Message)
+	var profile Profile
+	if _, err := api.Decode(response.Response, response.Payload, &profile); err != nil {
+		return nil, err
 	}
 
-	return &ret.Details, nil
+	return &profile, nil
 }
\ No newline at end of file
@@ -1,11 +1,13 @@
 package throttler
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 
 	"github.com/9spokes/go/logging/v3"
 )
@@ -15,6 +17,8 @@ type Context struct {
 	URL          string
 	ClientID     string
 	ClientSecret string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
 type ThrottlerOptions struct {
@@ -32,15 +36,23 @@ var (
 //
 // The function will block until a valid token is returned from the throttling service hence you may wish to implement a timeout
 func (ctx Context) GetToken(osp string, opt ThrottlerOptions) error {
+	return ctx.GetTokenContext(context.Background(), osp, opt)
+}
+
+// GetTokenContext is like GetToken but the context can be used to set a
+// timeout or cancel the request. Cancelling the context also interrupts the
+// wait between two attempts.
+func (ctx Context) GetTokenContext(c context.Context, osp string, opt ThrottlerOptions) error {
 
 	logging.Debugf("[CorrID:%s][%s] Getting rate-limiting token", opt.CorrelationID, osp)
 
 	url := fmt.Sprintf("%s/token/%s", ctx.URL, osp)
 	logging.Debugf("[CorrID:%s][%s] URL is: %s", opt.CorrelationID, osp, ctx.URL)
 
-	request := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
+	request := Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
@@ -48,12 +60,11 @@ func (ctx Context) GetToken(osp string, opt ThrottlerOptions) error {
 		Headers: map[string]string{
 			"x-correlation-id": opt.CorrelationID,
 		},
-		ContentType: "application/json",
 	}
 
 	for i := 0; i < opt.Retries; i++ {
 		logging.Debugf("[CorrID:%s][%s] Attempt #%d", opt.CorrelationID, osp, i+1)
-		response, err := request.Get()
+		response, err := request.Get(c)
 		if err != nil {
 			return fmt.Errorf("failed to issue request: %w", err)
 		}
@@ -68,7 +79,11 @@ func (ctx Context) GetToken(osp string, opt ThrottlerOptions) error {
 			return fmt.Errorf("unexpected response from throttling service: %d", response.StatusCode)
 		}
 
-		time.Sleep(5 * time.Second)
+		select {
+		case <-c.Done():
+			return fmt.Errorf("while waiting for a rate-limiting token: %w", c.Err())
+		case <-time.After(5 * time.Second):
+		}
 	}
 
 	logging.Errorf("[CorrID:%s][%s] Failed to acquire rate-limtiing token after %d attempts", opt.CorrelationID, osp, opt.Retries)
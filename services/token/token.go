@@ -1,13 +1,15 @@
 package token
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/9spokes/go/api"
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v3"
 	"github.com/9spokes/go/types"
 )
@@ -26,41 +28,43 @@ type Context struct {
 	URL          string
 	ClientID     string
 	ClientSecret string
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
-func (ctx Context) InitiateETL(id string) error {
-
-	url := fmt.Sprintf("%s/connections/%s?action=etl", ctx.URL, id)
-
-	logging.Debugf("Invoking Token service at: %s", url)
-
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
+// Returns a new request to the Token service authenticated with the client
+// credentials.
+func (ctx Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
 		},
-		ContentType: "application/json",
-	}.Get()
-
-	if err != nil {
-		return err
 	}
+}
 
-	var parsed struct {
-		Status  string           `json:"status"`
-		Message string           `json:"message"`
-		Details types.Connection `json:"details"`
-	}
+func (ctx Context) InitiateETL(id string) error {
+	return ctx.InitiateETLContext(context.Background(), id)
+}
+
+// InitiateETLContext is like InitiateETL but the context can be used to set a
+// timeout or cancel the request.
+func (ctx Context) InitiateETLContext(c context.Context, id string) error {
+
+	url := fmt.Sprintf("%s/connections/%s?action=etl", ctx.URL, id)
+
+	logging.Debugf("Invoking Token service at: %s", url)
 
-	if json.Unmarshal(response.Body, &parsed); err != nil {
+	response, err := ctx.request(url).Get(c)
+	if err != nil {
 		return err
 	}
 
-	if parsed.Status != "ok" {
-		e := fmt.Sprintf("Non-OK response received from Token service: %s", parsed.Message)
-		return fmt.Errorf(e)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
 	return nil
@@ -68,25 +72,29 @@ func (ctx Context) InitiateETL(id string) error {
 
 // Returns a connection by ID from the designated Token service instance
 func (ctx Context) GetConnection(id string) (*types.Connection, error) {
-	return ctx.getConnection(id, false)
+	return ctx.GetConnectionContext(context.Background(), id)
+}
+
+// GetConnectionContext is like GetConnection but the context can be used to
+// set a timeout or cancel the request.
+func (ctx Context) GetConnectionContext(c context.Context, id string) (*types.Connection, error) {
+	return ctx.getConnection(c, id, false)
 }
 
 // Returns a connection by ID from the designated Token service instance. Refreshes
 // the access token before returning the connection if necessary.
 func (ctx Context) GetConnectionWithRefresh(id string) (*types.Connection, error) {
-	return ctx.getConnection(id, true)
+	return ctx.GetConnectionWithRefreshContext(context.Background(), id)
 }
 
-func (ctx Context) getConnection(id string, refresh bool) (*types.Connection, error) {
-	req := http.Request{
-		URL: fmt.Sprintf("%s/connections/%s", ctx.URL, id),
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}
+// GetConnectionWithRefreshContext is like GetConnectionWithRefresh but the
+// context can be used to set a timeout or cancel the request.
+func (ctx Context) GetConnectionWithRefreshContext(c context.Context, id string) (*types.Connection, error) {
+	return ctx.getConnection(c, id, true)
+}
+
+func (ctx Context) getConnection(c context.Context, id string, refresh bool) (*types.Connection, error) {
+	req := ctx.request(fmt.Sprintf("%s/connections/%s", ctx.URL, id))
 
 	if refresh {
 		req.Query = map[string]string{"action": "refresh"}
@@ -94,27 +102,17 @@ func (ctx Context) getConnection(id string, refresh bool) (*types.Connection, er
 
 	logging.Debugf("Invoking Token service at: %s", req.URL)
 
-	response, err := req.Get()
+	response, err := req.Get(c)
 	if err != nil {
 		return nil, err
 	}
 
-	var parsed struct {
-		Status  string           `json:"status"`
-		Message string           `json:"message"`
-		Details types.Connection `json:"details"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return nil, err
-	}
-
-	if parsed.Status != "ok" {
-		e := fmt.Sprintf("Non-OK response received from Token service: %s", parsed.Message)
-		return nil, fmt.Errorf(e)
+	var conn types.Connection
+	if _, err := api.Decode(response.Response, response.Payload, &conn); err != nil {
+		return nil, fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
-	return &parsed.Details, nil
+	return &conn, nil
 }
 
 type GetConnectionsOptions struct {
@@ -130,6 +128,12 @@ type GetConnectionsOptions struct {
 // specifies the maximum number of documents to be returned and `Offset` can
 // be used together with `Limit` to break down the list into multiple pages.
 func (ctx Context) GetConnections(opts GetConnectionsOptions) ([]types.Connection, error) {
+	return ctx.GetConnectionsContext(context.Background(), opts)
+}
+
+// GetConnectionsContext is like GetConnections but the context can be used to
+// set a timeout or cancel the request.
+func (ctx Context) GetConnectionsContext(c context.Context, opts GetConnectionsOptions) ([]types.Connection, error) {
 
 	f, err := json.Marshal(opts.Filter)
 	if err != nil {
@@ -140,81 +144,61 @@ func (ctx Context) GetConnections(opts GetConnectionsOptions) ([]types.Connectio
 		opts.Selector = []string{"osp"}
 	}
 
-	url := fmt.Sprintf("%s/connections?filter=%s&selector=%s&limit=%d&offset=%d",
-		ctx.URL,
-		f,
-		strings.Join(opts.Selector, ","),
-		opts.Limit,
-		opts.Offset,
-	)
-
-	req := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
+	req := ctx.request(fmt.Sprintf("%s/connections", ctx.URL))
+	req.Query = map[string]string{
+		"filter":   string(f),
+		"selector": strings.Join(opts.Selector, ","),
+		"limit":    fmt.Sprint(opts.Limit),
+		"offset":   fmt.Sprint(opts.Offset),
 	}
 
-	logging.Debugf("Calling %s", req.URL)
+	logging.Debugf("Calling %s", req)
 
-	res, err := req.Get()
+	res, err := req.Get(c)
 	if err != nil {
 		return nil, fmt.Errorf("while calling %s: %w", req.URL, err)
 	}
 
-	var parsed struct {
-		Status  string             `json:"status"`
-		Details []types.Connection `json:"details"`
-		Message string             `json:"message"`
-	}
-	if json.Unmarshal(res.Body, &parsed); err != nil {
-		return nil, fmt.Errorf("while unmarshalling response '%s': %w", res.Body, err)
-	}
-
-	if parsed.Status != "ok" {
-		err := fmt.Errorf(parsed.Message)
+	var conns []types.Connection
+	if _, err := api.Decode(res.Response, res.Payload, &conns); err != nil {
 		return nil, fmt.Errorf("non-ok response received: %w", err)
 	}
 
-	return parsed.Details, nil
+	return conns, nil
 }
 
 // GetOSP returns an OSP definition from the Token service
 func (ctx Context) GetOSP(osp string) (types.Document, error) {
+	return ctx.GetOSPContext(context.Background(), osp)
+}
 
-	url := fmt.Sprintf("%s/osp/%s", ctx.URL, osp)
+// GetOSPContext is like GetOSP but the context can be used to set a timeout or
+// cancel the request.
+func (ctx Context) GetOSPContext(c context.Context, osp string) (types.Document, error) {
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
+	url := fmt.Sprintf("%s/osp/%s", ctx.URL, osp)
 
+	response, err := ctx.request(url).Get(c)
 	if err != nil {
 		return nil, fmt.Errorf("while interacting with token services: %s", err.Error())
 	}
 
-	var ret struct {
-		Status  string         `json:"status"`
-		Details types.Document `json:"details"`
-		Message string         `json:"message"`
-	}
-
-	if err := json.Unmarshal(response.Body, &ret); err != nil {
-		return nil, fmt.Errorf("while unmarshalling message: %s", err.Error())
+	var doc types.Document
+	if _, err := api.Decode(response.Response, response.Payload, &doc); err != nil {
+		return nil, fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
-	return ret.Details, nil
+	return doc, nil
 }
 
 // SetConnectionStatus returns a connection by ID from the designated Token service instance
 func (ctx Context) SetConnectionStatus(id string, status string, reason string) error {
+	return ctx.SetConnectionStatusContext(context.Background(), id, status, reason)
+}
+
+// SetConnectionStatusContext is like SetConnectionStatus but the context can be
+// used to set a timeout or cancel the request.
+func (ctx Context) SetConnectionStatusContext(c context.Context, id string, status string, reason string) error {
 
 	if status != StatusNotConnected {
 		return fmt.Errorf("cannot set status to %s. %s != %s", status, status, StatusNotConnected)
@@ -228,32 +212,17 @@ func (ctx Context) SetConnectionStatus(id string, status string, reason string)
 	body.Add("status", status)
 	body.Add("reason", reason)
 
-	response, err := http.Request{
-		URL: link,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/x-www-form-urlencoded",
-		Body:        []byte(body.Encode()),
-	}.Post()
+	req := ctx.request(link)
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = []byte(body.Encode())
 
+	response, err := req.Post(c)
 	if err != nil {
 		return err
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return err
-	}
-
-	if parsed.Status != "ok" {
-		return fmt.Errorf("Non-OK response received from Token service: %s", parsed.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
 	return nil
@@ -261,6 +230,12 @@ func (ctx Context) SetConnectionStatus(id string, status string, reason string)
 
 // SetConnectionSetting updates connection setting by ID from the designated Token service instance
 func (ctx Context) SetConnectionSetting(id string, settings types.Document) error {
+	return ctx.SetConnectionSettingContext(context.Background(), id, settings)
+}
+
+// SetConnectionSettingContext is like SetConnectionSetting but the context can
+// be used to set a timeout or cancel the request.
+func (ctx Context) SetConnectionSettingContext(c context.Context, id string, settings types.Document) error {
 
 	if settings == nil {
 		return fmt.Errorf("the new settings provided is empty")
@@ -273,32 +248,16 @@ func (ctx Context) SetConnectionSetting(id string, settings types.Document) erro
 		return err
 	}
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-		Body:        newSettings,
-	}.Post()
+	req := ctx.request(url)
+	req.Body = newSettings
 
+	response, err := req.Post(c)
 	if err != nil {
 		return err
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return err
-	}
-
-	if parsed.Status != "ok" {
-		return fmt.Errorf("Non-OK response received from Token service: %s", parsed.Message)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
 	return nil
@@ -306,6 +265,12 @@ func (ctx Context) SetConnectionSetting(id string, settings types.Document) erro
 
 // CreateConnection requests the designated Token service instance to create a new connection
 func (ctx Context) CreateConnection(form map[string]string) (*types.Connection, error) {
+	return ctx.CreateConnectionContext(context.Background(), form)
+}
+
+// CreateConnectionContext is like CreateConnection but the context can be used
+// to set a timeout or cancel the request.
+func (ctx Context) CreateConnectionContext(c context.Context, form map[string]string) (*types.Connection, error) {
 
 	// validate parameters
 	if form["osp"] == "" {
@@ -324,72 +289,43 @@ func (ctx Context) CreateConnection(form map[string]string) (*types.Connection,
 
 	logging.Debugf("Invoking Token service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/x-www-form-urlencoded",
-		Body:        []byte(params.Encode()),
-	}.Post()
+	req := ctx.request(url)
+	req.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	req.Body = []byte(params.Encode())
 
+	response, err := req.Post(c)
 	if err != nil {
 		return nil, err
 	}
 
-	var parsed struct {
-		Status  string           `json:"status"`
-		Message string           `json:"message"`
-		Details types.Connection `json:"details"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return nil, err
+	var conn types.Connection
+	if _, err := api.Decode(response.Response, response.Payload, &conn); err != nil {
+		return nil, fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
-	if parsed.Status != "ok" {
-		e := fmt.Sprintf("Non-OK response received from Token service: %s", parsed.Message)
-		return nil, fmt.Errorf(e)
-	}
-
-	return &parsed.Details, nil
+	return &conn, nil
 }
 
 // RemoveConnection requests the designated Token service instance to remove a connection
 func (ctx Context) RemoveConnection(id string) error {
+	return ctx.RemoveConnectionContext(context.Background(), id)
+}
+
+// RemoveConnectionContext is like RemoveConnection but the context can be used
+// to set a timeout or cancel the request.
+func (ctx Context) RemoveConnectionContext(c context.Context, id string) error {
 
 	url := fmt.Sprintf("%s/connections/%s", ctx.URL, id)
 
 	logging.Debugf("Invoking Token service at: %s", url)
 
-	response, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Delete()
-
+	response, err := ctx.request(url).Delete(c)
 	if err != nil {
 		return err
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return err
-	}
-
-	if parsed.Status != "ok" {
-		e := fmt.Sprintf("Non-OK response received from Token service: %s", parsed.Message)
-		return fmt.Errorf(e)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
 	return nil
@@ -397,6 +333,12 @@ func (ctx Context) RemoveConnection(id string) error {
 
 // ManageConnection asks the designated Token service instance to perform an action on the specified connection
 func (ctx Context) ManageConnection(id string, action string, params map[string]string) error {
+	return ctx.ManageConnectionContext(context.Background(), id, action, params)
+}
+
+// ManageConnectionContext is like ManageConnection but the context can be used
+// to set a timeout or cancel the request.
+func (ctx Context) ManageConnectionContext(c context.Context, id string, action string, params map[string]string) error {
 
 	if action == "" {
 		return fmt.Errorf("the action must be specified")
@@ -418,33 +360,13 @@ func (ctx Context) ManageConnection(id string, action string, params map[string]
 
 	logging.Debugf("Invoking Token service at: %s", u.String())
 
-	response, err := http.Request{
-		URL: u.String(),
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		ContentType: "application/json",
-	}.Get()
-
+	response, err := ctx.request(u.String()).Get(c)
 	if err != nil {
 		return err
 	}
 
-	var parsed struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Details string `json:"details"`
-	}
-
-	if json.Unmarshal(response.Body, &parsed); err != nil {
-		return err
-	}
-
-	if parsed.Status != "ok" {
-		e := fmt.Sprintf("Non-OK response received from Token service: %s", parsed.Message)
-		return fmt.Errorf(e)
+	if _, err := api.Decode(response.Response, response.Payload, nil); err != nil {
+		return fmt.Errorf("Non-OK response received from Token service: %w", err)
 	}
 
 	return nil
@@ -453,31 +375,24 @@ func (ctx Context) ManageConnection(id string, action string, params map[string]
 // Triggers an extraction for the specified connection. "opts" can be used to
 // specify any parameters such as the extraction type (complete or partial).
 func (ctx Context) TriggerExtraction(conn string, opts map[string]string) error {
+	return ctx.TriggerExtractionContext(context.Background(), conn, opts)
+}
 
-	req := http.Request{
-		URL:   fmt.Sprintf("%s/connections/%s/extract", ctx.URL, conn),
-		Query: opts,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-	}
+// TriggerExtractionContext is like TriggerExtraction but the context can be
+// used to set a timeout or cancel the request.
+func (ctx Context) TriggerExtractionContext(c context.Context, conn string, opts map[string]string) error {
+
+	req := ctx.request(fmt.Sprintf("%s/connections/%s/extract", ctx.URL, conn))
+	req.Query = opts
 
 	logging.Debugf("Calling %s with params %v", req.URL, opts)
 
-	res, err := req.Put()
+	res, err := req.Put(c)
 	if err != nil {
 		return err
 	}
 
-	var parsed api.Response
-	if json.Unmarshal(res.Body, &parsed); err != nil {
-		return err
-	}
-
-	if parsed.Status != "ok" {
-		err := fmt.Errorf(parsed.Message)
+	if _, err := api.Decode(res.Response, res.Payload, nil); err != nil {
 		return fmt.Errorf("non-ok response received: %w", err)
 	}
 
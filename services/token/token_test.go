@@ -1,12 +1,15 @@
 package token
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/9spokes/go/api"
 	"github.com/9spokes/go/types"
@@ -157,3 +160,39 @@ func TestManageConnection(t *testing.T) {
 		}
 	}
 }
+
+func TestGetConnectionContext(t *testing.T) {
+
+	stage := "token.GetConnectionContext"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Query().Get("action") == "refresh" {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		api.SuccessResponse(w, types.Connection{ID: "uuid", OSP: "9spokes"}, http.StatusOK)
+	}))
+	defer ts.Close()
+
+	ctx := Context{URL: ts.URL}
+
+	fmt.Printf("Testing Case: [%s]: %s\n", stage, "OK response")
+
+	conn, err := ctx.GetConnectionContext(context.Background(), "uuid")
+	if err != nil {
+		t.Fatalf("Test case failed. Unexpected error: %s", err.Error())
+	}
+	if conn.OSP != "9spokes" {
+		t.Fatalf("Test case failed. Expected OSP '9spokes', received '%s'", conn.OSP)
+	}
+
+	fmt.Printf("Testing Case: [%s]: %s\n", stage, "Deadline exceeded")
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := ctx.GetConnectionWithRefreshContext(c, "uuid"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Test case failed. Expected deadline exceeded error, got '%v'", err)
+	}
+}
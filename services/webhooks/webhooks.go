@@ -1,9 +1,11 @@
 package webhooks
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 
-	"github.com/9spokes/go/http"
+	Http "github.com/9spokes/go/http/v2"
 	"github.com/9spokes/go/logging/v3"
 )
 
@@ -13,15 +15,17 @@ type Context struct {
 	ClientID     string
 	ClientSecret string
 	Logger       *logging.Logger
+	// Optional HTTP client, http.DefaultClient is used if not set
+	Client *http.Client
 }
 
-// CreateWebhook creates a new Webhook listener
-func (ctx *Context) CreateWebhook(osp string, connection string) error {
-
-	url := fmt.Sprintf("%s/%s/connections/%s", ctx.URL, osp, connection)
-	_, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
+// Returns a new request to the webhooks service authenticated with the client
+// credentials.
+func (ctx *Context) request(url string) *Http.Request {
+	return &Http.Request{
+		URL:    url,
+		Client: ctx.Client,
+		Authorization: Http.Authorization{
 			Scheme:   "basic",
 			Username: ctx.ClientID,
 			Password: ctx.ClientSecret,
@@ -29,28 +33,49 @@ func (ctx *Context) CreateWebhook(osp string, connection string) error {
 		Headers: map[string]string{
 			"internal-service": "true",
 		},
-		ContentType: "application/json",
-	}.Post()
+	}
+}
 
-	return err
+// CreateWebhook creates a new Webhook listener
+func (ctx *Context) CreateWebhook(osp string, connection string) error {
+	return ctx.CreateWebhookContext(context.Background(), osp, connection)
+}
+
+// CreateWebhookContext is like CreateWebhook but the context can be used to set
+// a timeout or cancel the request.
+func (ctx *Context) CreateWebhookContext(c context.Context, osp string, connection string) error {
+
+	url := fmt.Sprintf("%s/%s/connections/%s", ctx.URL, osp, connection)
+	response, err := ctx.request(url).Post(c)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode > 399 {
+		return fmt.Errorf("non-OK response: %s", response.Payload)
+	}
+
+	return nil
 }
 
 // DeleteWebook removes a webhook listener
 func (ctx *Context) DeleteWebhook(osp string, connection string) error {
+	return ctx.DeleteWebhookContext(context.Background(), osp, connection)
+}
+
+// DeleteWebhookContext is like DeleteWebhook but the context can be used to set
+// a timeout or cancel the request.
+func (ctx *Context) DeleteWebhookContext(c context.Context, osp string, connection string) error {
 
 	url := fmt.Sprintf("%s/%s/connections/%s", ctx.URL, osp, connection)
-	_, err := http.Request{
-		URL: url,
-		Authentication: http.Authentication{
-			Scheme:   "basic",
-			Username: ctx.ClientID,
-			Password: ctx.ClientSecret,
-		},
-		Headers: map[string]string{
-			"internal-service": "true",
-		},
-		ContentType: "application/json",
-	}.Delete()
+	response, err := ctx.request(url).Delete(c)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode > 399 {
+		return fmt.Errorf("non-OK response: %s", response.Payload)
+	}
 
-	return err
+	return nil
 }
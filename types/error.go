@@ -17,12 +17,50 @@ const (
 	ErrMissingContentTypeHeader string = "content-type header missing"
 	ErrMissingAuthorizationCode string = "authorization code missing"
 	ErrMissingRefreshToken      string = "refresh token missing"
+	ErrMissingUsername          string = "username missing"
+	ErrMissingDeviceCode        string = "device code missing"
 
 	ErrDeserialiseFailed     string = "deserialise failed"
 	ErrResponseFormatUnknown string = "response format unknown"
 	ErrError                 string = "error"
 )
 
+// Error codes returned by OAuth2 endpoints (RFC 6749)
+const (
+	ErrInvalidRequest         string = "invalid_request"
+	ErrInvalidClient          string = "invalid_client"
+	ErrInvalidGrant           string = "invalid_grant"
+	ErrUnauthorizedClient     string = "unauthorized_client"
+	ErrUnsupportedGrantType   string = "unsupported_grant_type"
+	ErrInvalidScope           string = "invalid_scope"
+	ErrAccessDenied           string = "access_denied"
+	ErrServerError            string = "server_error"
+	ErrTemporarilyUnavailable string = "temporarily_unavailable"
+)
+
+// Error codes returned by the token endpoint during the OAuth2 device
+// authorization flow (RFC 8628)
+const (
+	ErrAuthorizationPending string = "authorization_pending"
+	ErrSlowDown             string = "slow_down"
+	ErrExpiredToken         string = "expired_token"
+)
+
+// OAuth2ErrorSeverity returns the severity of an OAuth2 error code. Errors
+// which require the user to go through the authorization again, such as a
+// revoked consent, are fatal while errors which may go away on their own are
+// warnings.
+func OAuth2ErrorSeverity(code string) string {
+	switch code {
+	case ErrInvalidGrant, ErrInvalidClient, ErrUnauthorizedClient, ErrAccessDenied,
+		ErrUnsupportedGrantType, ErrInvalidScope, ErrExpiredToken:
+		return ErrSeverityFatal
+	case ErrServerError, ErrTemporarilyUnavailable, ErrAuthorizationPending, ErrSlowDown:
+		return ErrSeverityWarn
+	}
+	return ErrSeverityError
+}
+
 type ErrorResponse struct {
 	Err        error
 	Message    string `json:"message"`
@@ -45,3 +83,20 @@ func (e ErrorResponse) Error() string {
 func (e ErrorResponse) IsFatal() bool {
 	return e.Severity == ErrSeverityFatal
 }
+
+// IsRevoked returns true if the error means that the user's consent, or the
+// grant it produced, is no longer valid and the user has to authorize the
+// connection again.
+func (e ErrorResponse) IsRevoked() bool {
+	return e.ID == ErrInvalidGrant || e.ID == ErrAccessDenied
+}
+
+// IsTransient returns true if the error is likely to go away on its own and
+// the request can be retried later.
+func (e ErrorResponse) IsTransient() bool {
+	switch e.ID {
+	case ErrServerError, ErrTemporarilyUnavailable, ErrTooManyRequests:
+		return true
+	}
+	return e.HTTPStatus == 429 || e.HTTPStatus >= 500
+}